@@ -33,31 +33,40 @@ func Create(ttl time.Duration) wfcache.StorageMaker {
 	}
 }
 
+func (s *BasicStorage) Name() string {
+	return "basic"
+}
+
+func (s *BasicStorage) Local() bool {
+	return true
+}
+
 func (s *BasicStorage) TimeToLive() time.Duration {
 	return s.ttl
 }
 
 func (s *BasicStorage) Get(ctx context.Context, key string) *wfcache.CacheItem {
 	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
 	m, found := s.pairs[key]
+	s.mutex.RUnlock()
 
-	if found {
-		if s.ttl == NoTTL || time.Now().UTC().Before(time.Unix(m.ExpiresAt, 0)) {
-			return m
-		} else {
-			s.Del(ctx, key)
-		}
+	if !found {
+		return nil
 	}
 
-	return nil
+	if !m.Kept() {
+		s.Del(ctx, key)
+		return nil
+	}
+
+	if m.Expired() {
+		return nil
+	}
+
+	return m
 }
 
 func (s *BasicStorage) BatchGet(ctx context.Context, keys []string) (results []*wfcache.CacheItem) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
 	for _, key := range keys {
 		m := s.Get(ctx, key)
 
@@ -69,29 +78,75 @@ func (s *BasicStorage) BatchGet(ctx context.Context, keys []string) (results []*
 	return results
 }
 
+func (s *BasicStorage) BatchFetchStale(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*wfcache.CacheItem{}
+	for _, key := range keys {
+		m, found := s.pairs[key]
+
+		if found && m.Kept() {
+			results = append(results, m)
+		}
+	}
+
+	return results, nil
+}
+
 func (s *BasicStorage) Set(ctx context.Context, key string, data []byte) error {
+	return s.SetItem(ctx, &wfcache.CacheItem{
+		Key:   key,
+		Value: data,
+	})
+}
+
+func (s *BasicStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	cacheItems := make([]*wfcache.CacheItem, 0, len(pairs))
+	for key, data := range pairs {
+		cacheItems = append(cacheItems, &wfcache.CacheItem{
+			Key:   key,
+			Value: data,
+		})
+	}
+
+	return s.BatchSetItems(ctx, cacheItems)
+}
+
+func (s *BasicStorage) SetItem(ctx context.Context, cacheItem *wfcache.CacheItem) error {
+	return s.BatchSetItems(ctx, []*wfcache.CacheItem{cacheItem})
+}
+
+func (s *BasicStorage) BatchSetItems(ctx context.Context, cacheItems []*wfcache.CacheItem) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.pairs[key] = &wfcache.CacheItem{
-		Key:       key,
-		Value:     data,
-		ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
+	for _, cacheItem := range cacheItems {
+		item := *cacheItem
+		item.ExpiresAt = wfcache.ClampExpiry(item.ExpiresAt, s.ttl)
+
+		s.pairs[item.Key] = &item
 	}
 
 	return nil
 }
 
-func (s *BasicStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+func (s *BasicStorage) BatchTouch(ctx context.Context, keys []string) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for key, data := range pairs {
-		s.pairs[key] = &wfcache.CacheItem{
-			Key:       key,
-			Value:     data,
-			ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
+	for _, key := range keys {
+		m, found := s.pairs[key]
+
+		if !found || m.Absent || m.Expired() {
+			continue
 		}
+
+		// items handed out are never mutated
+		item := *m
+		item.ExpiresAt = wfcache.ClampExpiry(0, s.ttl)
+
+		s.pairs[key] = &item
 	}
 
 	return nil
@@ -105,3 +160,14 @@ func (s *BasicStorage) Del(ctx context.Context, key string) error {
 
 	return nil
 }
+
+func (s *BasicStorage) BatchDel(ctx context.Context, keys []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(s.pairs, key)
+	}
+
+	return nil
+}
@@ -12,13 +12,27 @@ import (
 type BigCacheStorage struct {
 	bigCache *bigcache.BigCache
 	ttl      time.Duration
+	grace    time.Duration
 }
 
 func Create(ttl time.Duration) wfcache.StorageMaker {
 	return CreateWithConfig(bigcache.DefaultConfig(ttl))
 }
 
+// CreateWithGrace creates a storage that keeps expired items for up to grace,
+// to serve them with Config.StaleIfError. BigCache evicts entries once they
+// outlive its LifeWindow, which covers both.
+func CreateWithGrace(ttl time.Duration, grace time.Duration) wfcache.StorageMaker {
+	return createWithGrace(bigcache.DefaultConfig(ttl+grace), ttl, grace)
+}
+
+// CreateWithConfig creates a storage whose ttl is conf.LifeWindow. It keeps no
+// expired items.
 func CreateWithConfig(conf bigcache.Config) wfcache.StorageMaker {
+	return createWithGrace(conf, conf.LifeWindow, 0)
+}
+
+func createWithGrace(conf bigcache.Config, ttl time.Duration, grace time.Duration) wfcache.StorageMaker {
 	return func() (wfcache.Storage, error) {
 		bigCache, err := bigcache.NewBigCache(conf)
 
@@ -28,30 +42,63 @@ func CreateWithConfig(conf bigcache.Config) wfcache.StorageMaker {
 
 		s := &BigCacheStorage{
 			bigCache: bigCache,
-			ttl:      conf.LifeWindow,
+			ttl:      ttl,
+			grace:    grace,
 		}
 
 		return s, nil
 	}
 }
 
+func (s *BigCacheStorage) Name() string {
+	return "bigcache"
+}
+
+func (s *BigCacheStorage) Local() bool {
+	return true
+}
+
 func (s *BigCacheStorage) TimeToLive() time.Duration {
 	return s.ttl
 }
 
 func (s *BigCacheStorage) Get(ctx context.Context, key string) *wfcache.CacheItem {
+	cacheItem, _ := s.Fetch(ctx, key)
+
+	return cacheItem
+}
+
+func (s *BigCacheStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	cacheItem, err := s.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheItem == nil || cacheItem.Expired() {
+		return nil, nil
+	}
+
+	return cacheItem, nil
+}
+
+// fetch reads the item whether it has expired or not
+func (s *BigCacheStorage) fetch(key string) (*wfcache.CacheItem, error) {
 	result, err := s.bigCache.Get(key)
+	if err == bigcache.ErrEntryNotFound {
+		return nil, nil
+	}
+
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	cacheItem := wfcache.CacheItem{}
 	err = json.Unmarshal(result, &cacheItem)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	return &cacheItem
+	return &cacheItem, nil
 }
 
 func (s *BigCacheStorage) BatchGet(ctx context.Context, keys []string) (results []*wfcache.CacheItem) {
@@ -66,18 +113,64 @@ func (s *BigCacheStorage) BatchGet(ctx context.Context, keys []string) (results
 	return results
 }
 
+func (s *BigCacheStorage) BatchFetch(ctx context.Context, keys []string) (results []*wfcache.CacheItem, err error) {
+	for _, key := range keys {
+		m, fetchErr := s.Fetch(ctx, key)
+
+		if fetchErr != nil {
+			err = fetchErr
+			continue
+		}
+
+		if m != nil {
+			results = append(results, m)
+		}
+	}
+
+	return results, err
+}
+
+// BatchFetchStale returns expired items kept for the grace the storage was
+// created with.
+func (s *BigCacheStorage) BatchFetchStale(ctx context.Context, keys []string) (results []*wfcache.CacheItem, err error) {
+	for _, key := range keys {
+		m, fetchErr := s.fetch(key)
+
+		if fetchErr != nil {
+			err = fetchErr
+			continue
+		}
+
+		if m != nil && m.Kept() {
+			results = append(results, m)
+		}
+	}
+
+	return results, err
+}
+
 func (s *BigCacheStorage) Set(ctx context.Context, key string, data []byte) error {
-	item, err := json.Marshal(wfcache.CacheItem{
-		Key:       key,
-		Value:     data,
-		ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
+	return s.SetItem(ctx, &wfcache.CacheItem{
+		Key:   key,
+		Value: data,
 	})
+}
+
+func (s *BigCacheStorage) SetItem(ctx context.Context, cacheItem *wfcache.CacheItem) error {
+	item := *cacheItem
+	item.ExpiresAt = wfcache.ClampExpiry(item.ExpiresAt, s.ttl)
+
+	// entries are evicted past the ttl and grace of the storage
+	if item.Grace > s.grace {
+		item.Grace = s.grace
+	}
 
+	v, err := json.Marshal(item)
 	if err != nil {
 		return err
 	}
 
-	err = s.bigCache.Set(key, item)
+	err = s.bigCache.Set(item.Key, v)
 	if err != nil {
 		return err
 	}
@@ -96,12 +189,56 @@ func (s *BigCacheStorage) BatchSet(ctx context.Context, pairs map[string][]byte)
 	return nil
 }
 
+func (s *BigCacheStorage) BatchSetItems(ctx context.Context, cacheItems []*wfcache.CacheItem) error {
+	for _, cacheItem := range cacheItems {
+		err := s.SetItem(ctx, cacheItem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *BigCacheStorage) BatchTouch(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		cacheItem, err := s.Fetch(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if cacheItem == nil || cacheItem.Absent {
+			continue
+		}
+
+		cacheItem.ExpiresAt = 0
+
+		err = s.SetItem(ctx, cacheItem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *BigCacheStorage) Del(ctx context.Context, key string) error {
 	err := s.bigCache.Delete(key)
 
-	if err != nil {
+	if err != nil && err != bigcache.ErrEntryNotFound {
 		return err
 	}
 
 	return nil
 }
+
+func (s *BigCacheStorage) BatchDel(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		err := s.Del(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
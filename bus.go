@@ -0,0 +1,164 @@
+package wfcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// Invalidation tells other instances of a cache to evict keys from their
+// local storage layers.
+type Invalidation struct {
+	// Source identifies the instance that published the invalidation, which
+	// ignores it.
+	Source string   `json:"source"`
+	Keys   []string `json:"keys"`
+}
+
+// InvalidationBus carries invalidations between the instances of a cache.
+// Subscribe returns a function that stops the handler from being called.
+type InvalidationBus interface {
+	Publish(ctx context.Context, invalidation *Invalidation) error
+	Subscribe(handler func(invalidation *Invalidation)) (unsubscribe func() error, err error)
+}
+
+// Localer is optionally implemented by storages that live in the memory of
+// each instance, e.g. to evict keys invalidated by another instance from them.
+type Localer interface {
+	Local() bool
+}
+
+func isLocal(storage Storage) bool {
+	if l, ok := storage.(Localer); ok {
+		return l.Local()
+	}
+
+	return false
+}
+
+// MemoryBus is an InvalidationBus for caches in the same process, e.g. in
+// tests. Invalidations are handled before Publish returns.
+type MemoryBus struct {
+	handlers map[int]func(invalidation *Invalidation)
+	next     int
+
+	mutex sync.RWMutex
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: map[int]func(invalidation *Invalidation){},
+	}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, invalidation *Invalidation) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(invalidation)
+	}
+
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(handler func(invalidation *Invalidation)) (func() error, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	id := b.next
+	b.next++
+
+	b.handlers[id] = handler
+
+	return func() error {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		delete(b.handlers, id)
+
+		return nil
+	}, nil
+}
+
+// publish tells the other instances to evict keys, once they were written
+// (or deleted) with err. It returns the error the mutation fails with.
+func (c *Cache) publish(ctx context.Context, keys []string, err error) error {
+	if c.bus == nil {
+		return err
+	}
+
+	// other instances evict the physical keys of a namespace
+	if c.namespace != nil {
+		physicalKeys, _, nsErr := c.namespace.physicalKeys(ctx, keys)
+		if nsErr != nil {
+			c.errorHandler(ctx, nsErr)
+			return err
+		}
+
+		keys = physicalKeys
+	}
+
+	pubErr := c.bus.Publish(ctx, &Invalidation{
+		Source: c.id,
+		Keys:   keys,
+	})
+
+	if pubErr == nil {
+		return err
+	}
+
+	pubErr = fmt.Errorf("wfcache: failed to publish invalidation: %w", pubErr)
+
+	if err != nil {
+		c.errorHandler(ctx, pubErr)
+		return err
+	}
+
+	return pubErr
+}
+
+// invalidate evicts keys invalidated by other instances from the local layers
+func (c *Cache) invalidate(invalidation *Invalidation) {
+	if invalidation.Source == c.id {
+		return
+	}
+
+	ctx := context.Background()
+
+	storages, err := c.Storages()
+	if err != nil {
+		return
+	}
+
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		if !isLocal(storage) {
+			continue
+		}
+
+		lctx, call := c.startLayerCall(ctx, i, storage, "Invalidate", invalidation.Keys)
+		err := batchDel(lctx, storage, invalidation.Keys)
+		call.deleted(err)
+
+		if err != nil {
+			errs.add(i, storage, "Invalidate", invalidation.Keys, err)
+		}
+	}
+
+	if err := errs.err(); err != nil {
+		c.errorHandler(ctx, err)
+	}
+}
+
+func newInstanceID() string {
+	b := make([]byte, 16)
+
+	// an unreadable source only makes instances unable to tell each other apart
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,350 @@
+package wfcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the error of reads skipping a storage layer whose circuit
+// is open.
+var ErrCircuitOpen = errors.New("wfcache: storage layer circuit is open")
+
+// CircuitState is the state of the circuit breaker of a storage layer.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen skips reads and holds back writes until the cool-down is
+	// over.
+	CircuitOpen
+	// CircuitHalfOpen lets a single call through to probe the layer.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// CircuitBreakerConfig configures the circuit breaker put around each storage
+// layer. Once Threshold calls in a row failed, the circuit opens: reads skip
+// the layer, failing with ErrCircuitOpen, and writes are held back. After the
+// CoolDown, a single call probes the layer, which closes the circuit if it
+// succeeds and opens it again otherwise.
+type CircuitBreakerConfig struct {
+	// Threshold is how many calls in a row must fail to open the circuit.
+	// Defaults to 5.
+	Threshold int
+
+	// CoolDown is how long an open circuit waits before probing the layer.
+	// Defaults to 10 seconds.
+	CoolDown time.Duration
+
+	// QueueSize is how many writes held back by an open circuit are queued, to
+	// be replayed in order before it closes. The oldest ones are dropped when
+	// the queue is full. Without a queue, writes are dropped, and the layer may
+	// serve values overwritten or deleted meanwhile until they expire.
+	QueueSize int
+}
+
+// circuitStorage is a storage layer behind a circuit breaker
+type circuitStorage struct {
+	storageWrapper
+
+	c     *Cache
+	layer int
+
+	threshold int
+	coolDown  time.Duration
+	queueSize int
+
+	mutex    sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	queue    []func(ctx context.Context) error
+}
+
+func newCircuitStorage(c *Cache, layer int, storage Storage, conf *CircuitBreakerConfig) *circuitStorage {
+	s := &circuitStorage{
+		storageWrapper: storageWrapper{storage},
+
+		c:     c,
+		layer: layer,
+
+		threshold: conf.Threshold,
+		coolDown:  conf.CoolDown,
+		queueSize: conf.QueueSize,
+	}
+
+	if s.threshold <= 0 {
+		s.threshold = 5
+	}
+
+	if s.coolDown <= 0 {
+		s.coolDown = 10 * time.Second
+	}
+
+	return s
+}
+
+// read calls fn unless the circuit is open
+func (s *circuitStorage) read(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.call(ctx, fn, false)
+}
+
+// write calls fn, or holds it back while the circuit is open
+func (s *circuitStorage) write(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.call(ctx, fn, true)
+}
+
+func (s *circuitStorage) call(ctx context.Context, fn func(ctx context.Context) error, write bool) error {
+	s.mutex.Lock()
+
+	if s.state == CircuitClosed {
+		s.mutex.Unlock()
+
+		err := fn(ctx)
+		s.report(ctx, err)
+
+		return err
+	}
+
+	if s.probing || time.Since(s.openedAt) < s.coolDown {
+		defer s.mutex.Unlock()
+
+		if write {
+			s.hold(fn)
+			return nil
+		}
+
+		return ErrCircuitOpen
+	}
+
+	s.probing = true
+	from := s.state
+	s.state = CircuitHalfOpen
+
+	// a write probes the layer itself unless writes held back before it must
+	// be replayed first
+	held := write && len(s.queue) != 0
+	if held {
+		s.hold(fn)
+	}
+
+	s.mutex.Unlock()
+
+	s.changed(ctx, from, CircuitHalfOpen)
+
+	return s.probe(ctx, fn, held)
+}
+
+// probe calls fn unless it's a write already held back, then replays the
+// writes held back, closing the circuit if all succeed. The result of fn is
+// returned either way, so that a read that probes the layer isn't failed by
+// writes that don't replay.
+func (s *circuitStorage) probe(ctx context.Context, fn func(ctx context.Context) error, held bool) error {
+	var err error
+	if !held {
+		err = fn(ctx)
+	}
+
+	if err == nil {
+		// writes are replayed even if the call that probes is cancelled
+		replayErr := s.replay(detachedContext{ctx})
+		if replayErr == nil {
+			s.changed(ctx, CircuitHalfOpen, CircuitClosed)
+			return nil
+		}
+
+		s.c.logger.Warn("wfcache: failed to replay writes queued for storage layer with an open circuit", "layer", s.layer, "storage", s.Name(), "err", replayErr)
+	}
+
+	s.mutex.Lock()
+	s.state = CircuitOpen
+	s.openedAt = time.Now()
+	s.probing = false
+	s.mutex.Unlock()
+
+	s.changed(ctx, CircuitHalfOpen, CircuitOpen)
+
+	// a held back write failing to replay is retried by the next probe
+	return err
+}
+
+// replay calls the writes held back in order, and closes the circuit once
+// there are none left. A write that fails is kept at the front of the queue.
+func (s *circuitStorage) replay(ctx context.Context) error {
+	for {
+		s.mutex.Lock()
+
+		if len(s.queue) == 0 {
+			s.state = CircuitClosed
+			s.failures = 0
+			s.probing = false
+			s.mutex.Unlock()
+
+			return nil
+		}
+
+		next := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mutex.Unlock()
+
+		err := next(ctx)
+		if err != nil {
+			s.mutex.Lock()
+			s.queue = append([]func(ctx context.Context) error{next}, s.queue...)
+			s.mutex.Unlock()
+
+			return err
+		}
+	}
+}
+
+// hold queues or drops a write held back by the circuit, with the lock held
+func (s *circuitStorage) hold(fn func(ctx context.Context) error) {
+	if s.queueSize <= 0 {
+		s.c.logger.Warn("wfcache: dropped write to storage layer with an open circuit", "layer", s.layer, "storage", s.Name())
+		return
+	}
+
+	if len(s.queue) >= s.queueSize {
+		s.c.logger.Warn("wfcache: dropped oldest write queued for storage layer with an open circuit", "layer", s.layer, "storage", s.Name(), "queued", len(s.queue))
+		s.queue = s.queue[1:]
+	}
+
+	s.queue = append(s.queue, fn)
+}
+
+// report counts the failures in a row of calls made while the circuit is
+// closed
+func (s *circuitStorage) report(ctx context.Context, err error) {
+	// callers giving up is no sign of an unhealthy layer
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	s.mutex.Lock()
+
+	if err == nil {
+		s.failures = 0
+		s.mutex.Unlock()
+
+		return
+	}
+
+	s.failures++
+
+	if s.state != CircuitClosed || s.failures < s.threshold {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.state = CircuitOpen
+	s.openedAt = time.Now()
+	s.mutex.Unlock()
+
+	s.changed(ctx, CircuitClosed, CircuitOpen)
+}
+
+func (s *circuitStorage) changed(ctx context.Context, from CircuitState, to CircuitState) {
+	for _, hooks := range s.c.hooks {
+		if hooks.OnCircuitChange != nil {
+			hooks.OnCircuitChange(ctx, s.layer, from, to)
+		}
+	}
+}
+
+func (s *circuitStorage) Get(ctx context.Context, key string) *CacheItem {
+	cacheItem, _ := s.Fetch(ctx, key)
+
+	return cacheItem
+}
+
+func (s *circuitStorage) BatchGet(ctx context.Context, keys []string) []*CacheItem {
+	cacheItems, _ := s.BatchFetch(ctx, keys)
+
+	return cacheItems
+}
+
+func (s *circuitStorage) Fetch(ctx context.Context, key string) (cacheItem *CacheItem, err error) {
+	err = s.read(ctx, func(ctx context.Context) error {
+		cacheItem, err = s.storageWrapper.Fetch(ctx, key)
+		return err
+	})
+
+	return cacheItem, err
+}
+
+func (s *circuitStorage) BatchFetch(ctx context.Context, keys []string) (cacheItems []*CacheItem, err error) {
+	err = s.read(ctx, func(ctx context.Context) error {
+		cacheItems, err = s.storageWrapper.BatchFetch(ctx, keys)
+		return err
+	})
+
+	return cacheItems, err
+}
+
+func (s *circuitStorage) BatchFetchStale(ctx context.Context, keys []string) (cacheItems []*CacheItem, err error) {
+	err = s.read(ctx, func(ctx context.Context) error {
+		cacheItems, err = s.storageWrapper.BatchFetchStale(ctx, keys)
+		return err
+	})
+
+	return cacheItems, err
+}
+
+func (s *circuitStorage) Set(ctx context.Context, key string, value []byte) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.Set(ctx, key, value)
+	})
+}
+
+func (s *circuitStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.BatchSet(ctx, pairs)
+	})
+}
+
+func (s *circuitStorage) SetItem(ctx context.Context, cacheItem *CacheItem) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.SetItem(ctx, cacheItem)
+	})
+}
+
+func (s *circuitStorage) BatchSetItems(ctx context.Context, cacheItems []*CacheItem) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.BatchSetItems(ctx, cacheItems)
+	})
+}
+
+func (s *circuitStorage) Del(ctx context.Context, key string) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.Del(ctx, key)
+	})
+}
+
+func (s *circuitStorage) BatchDel(ctx context.Context, keys []string) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.BatchDel(ctx, keys)
+	})
+}
+
+func (s *circuitStorage) BatchTouch(ctx context.Context, keys []string) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.storageWrapper.BatchTouch(ctx, keys)
+	})
+}
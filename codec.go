@@ -0,0 +1,68 @@
+package wfcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrCodecMismatch is the error of decoding an item encoded with another codec.
+var ErrCodecMismatch = errors.New("wfcache: item was encoded with another codec")
+
+// Codec encodes values before they are written to the storage layers and
+// decodes them back in GetInto and BatchGetInto. Items record the content type
+// of the codec they were encoded with, so values written with another codec
+// fail with ErrCodecMismatch rather than being decoded wrong.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type GobCodec struct{}
+
+func (GobCodec) ContentType() string {
+	return "application/x-gob"
+}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// decode decodes the value of an item into out, unless the item was encoded
+// with another codec. Items written without a content type, e.g. directly to
+// a storage, are decoded as is.
+func (c *Cache) decode(cacheItem *CacheItem, out interface{}) error {
+	if cacheItem.ContentType != "" && cacheItem.ContentType != c.codec.ContentType() {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrCodecMismatch, cacheItem.Key, cacheItem.ContentType, c.codec.ContentType())
+	}
+
+	return c.codec.Unmarshal(cacheItem.Value, out)
+}
@@ -0,0 +1,19 @@
+package msgpack
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type Codec struct{}
+
+func (Codec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
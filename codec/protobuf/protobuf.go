@@ -0,0 +1,31 @@
+package protobuf
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type Codec struct{}
+
+func (Codec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf: %T does not implement proto.Message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T does not implement proto.Message", v)
+	}
+
+	return proto.Unmarshal(data, m)
+}
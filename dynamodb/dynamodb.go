@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -22,6 +23,7 @@ type DynamoDbStorage struct {
 	dynamodbClient dynamodbiface.DynamoDBAPI
 	tableName      string
 	ttl            time.Duration
+	logger         wfcache.Logger
 }
 
 const maxReadOps = 100
@@ -62,7 +64,7 @@ func prepareDynamoDbTableIfNotExists(dynamodbClient dynamodbiface.DynamoDBAPI, t
 			TableName: aws.String(tableName),
 			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
 				Enabled:       aws.Bool(true),
-				AttributeName: aws.String("expiresAt"),
+				AttributeName: aws.String("keepUntil"),
 			},
 		})
 	}
@@ -86,6 +88,7 @@ func Create(dynamodbClient dynamodbiface.DynamoDBAPI, tableName string, ttl time
 			dynamodbClient: dynamodbClient,
 			tableName:      tableName,
 			ttl:            ttl,
+			logger:         wfcache.NopLogger{},
 		}
 
 		_, err := dynamodbClient.DescribeTable(&dynamodb.DescribeTableInput{
@@ -112,12 +115,31 @@ func Create(dynamodbClient dynamodbiface.DynamoDBAPI, tableName string, ttl time
 	}
 }
 
+func (s *DynamoDbStorage) Name() string {
+	return "dynamodb"
+}
+
+func (s *DynamoDbStorage) SetLogger(logger wfcache.Logger) {
+	s.logger = logger
+}
+
 func (s *DynamoDbStorage) TimeToLive() time.Duration {
 	return s.ttl
 }
 
 func (s *DynamoDbStorage) Get(ctx context.Context, key string) *wfcache.CacheItem {
-	result, err := s.dynamodbClient.GetItem(&dynamodb.GetItemInput{
+	cacheItem, err := s.Fetch(ctx, key)
+
+	if err != nil {
+		s.logger.Warn("dynamodb: failed to get key", "key", key, "err", err)
+		return nil
+	}
+
+	return cacheItem
+}
+
+func (s *DynamoDbStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	result, err := s.dynamodbClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]*dynamodb.AttributeValue{
 			"key": {
@@ -126,23 +148,58 @@ func (s *DynamoDbStorage) Get(ctx context.Context, key string) *wfcache.CacheIte
 		},
 	})
 
-	if err != nil || result.Item == nil {
-		return nil
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
 	}
 
 	cacheItem := wfcache.CacheItem{}
 	err = dynamodbattribute.UnmarshalMap(result.Item, &cacheItem)
 
 	if err != nil {
-		return nil
+		return nil, err
+	}
+
+	// dynamodb deletes expired items lazily, so they are filtered out here
+	if cacheItem.Expired() {
+		return nil, nil
 	}
 
-	return &cacheItem
+	return &cacheItem, nil
+}
+
+func (s *DynamoDbStorage) BatchGet(ctx context.Context, keys []string) []*wfcache.CacheItem {
+	results, err := s.BatchFetch(ctx, keys)
+
+	if err != nil {
+		s.logger.Warn("dynamodb: failed to get keys", "keys", len(keys), "err", err)
+	}
+
+	return results
 }
 
 // If you request more than 100 items, BatchGetItem returns a ValidationException
 // with the message "Too many items requested for the BatchGetItem call."
-func (s *DynamoDbStorage) BatchGet(ctx context.Context, keys []string) (results []*wfcache.CacheItem) {
+func (s *DynamoDbStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return s.batchFetch(ctx, keys, func(cacheItem *wfcache.CacheItem) bool {
+		return !cacheItem.Expired()
+	})
+}
+
+// BatchFetchStale returns expired items kept for their grace. DynamoDB's TTL
+// is on keepUntil, so that it doesn't delete them before.
+func (s *DynamoDbStorage) BatchFetchStale(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return s.batchFetch(ctx, keys, func(cacheItem *wfcache.CacheItem) bool {
+		return cacheItem.Kept()
+	})
+}
+
+func (s *DynamoDbStorage) batchFetch(ctx context.Context, keys []string, keep func(*wfcache.CacheItem) bool) (results []*wfcache.CacheItem, err error) {
+	var unmarshalErr error
+
 	queue := keys
 
 process:
@@ -160,7 +217,7 @@ process:
 	}
 
 	var result *dynamodb.BatchGetItemOutput
-	err := withRetry(ctx, func() error {
+	err = withRetry(ctx, s.logger, func() error {
 		var err error
 
 		result, err = s.dynamodbClient.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
@@ -175,8 +232,7 @@ process:
 	})
 
 	if err != nil {
-		// TODO(juliaqiuxy) log debug
-		return nil
+		return results, err
 	}
 
 	for _, table := range result.Responses {
@@ -184,12 +240,16 @@ process:
 			cacheItem := wfcache.CacheItem{}
 			err = dynamodbattribute.UnmarshalMap(item, &cacheItem)
 
+			// an item that can't be read is not a miss
 			if err != nil {
-				// TODO(juliaqiuxy) log debug
-				return nil
+				s.logger.Warn("dynamodb: failed to unmarshal item", "key", itemKey(item), "err", err)
+				unmarshalErr = err
+				continue
 			}
 
-			results = append(results, &cacheItem)
+			if keep(&cacheItem) {
+				results = append(results, &cacheItem)
+			}
 		}
 	}
 
@@ -201,6 +261,8 @@ process:
 			return *item["key"].S
 		}).([]string)
 
+		s.logger.Info("dynamodb: requeuing unprocessed keys", "op", "BatchGetItem", "keys", len(unprocessedKeys))
+
 		queue = append(queue, unprocessedKeys...)
 	}
 
@@ -208,23 +270,25 @@ process:
 		goto process
 	}
 
-	return results
+	return results, unmarshalErr
 }
 
 func (s *DynamoDbStorage) Set(ctx context.Context, key string, data []byte) error {
-	item, err := dynamodbattribute.MarshalMap(wfcache.CacheItem{
-		Key:       key,
-		Value:     data,
-		ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
+	return s.SetItem(ctx, &wfcache.CacheItem{
+		Key:   key,
+		Value: data,
 	})
+}
 
+func (s *DynamoDbStorage) SetItem(ctx context.Context, cacheItem *wfcache.CacheItem) error {
+	attrs, err := s.marshal(cacheItem)
 	if err != nil {
 		return err
 	}
 
 	_, err = s.dynamodbClient.PutItem(&dynamodb.PutItemInput{
 		TableName: aws.String(s.tableName),
-		Item:      item,
+		Item:      attrs,
 	})
 
 	if err != nil {
@@ -234,8 +298,51 @@ func (s *DynamoDbStorage) Set(ctx context.Context, key string, data []byte) erro
 	return nil
 }
 
+// marshal returns the attributes of an item, along with keepUntil, which the
+// TTL of the table is on, and graceSeconds to move it when the item is touched
+func (s *DynamoDbStorage) marshal(cacheItem *wfcache.CacheItem) (map[string]*dynamodb.AttributeValue, error) {
+	item := *cacheItem
+	item.ExpiresAt = wfcache.ClampExpiry(item.ExpiresAt, s.ttl)
+
+	attrs, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs["keepUntil"] = &dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(item.KeepUntil(), 10)),
+	}
+	attrs["graceSeconds"] = &dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(int64(item.Grace/time.Second), 10)),
+	}
+
+	return attrs, nil
+}
+
 func (s *DynamoDbStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
-	queue := funk.Keys(pairs).([]string)
+	cacheItems := make([]*wfcache.CacheItem, 0, len(pairs))
+	for key, data := range pairs {
+		cacheItems = append(cacheItems, &wfcache.CacheItem{
+			Key:   key,
+			Value: data,
+		})
+	}
+
+	return s.BatchSetItems(ctx, cacheItems)
+}
+
+func (s *DynamoDbStorage) BatchSetItems(ctx context.Context, cacheItems []*wfcache.CacheItem) error {
+	attrsByKey := map[string]map[string]*dynamodb.AttributeValue{}
+	for _, cacheItem := range cacheItems {
+		attrs, err := s.marshal(cacheItem)
+		if err != nil {
+			return err
+		}
+
+		attrsByKey[cacheItem.Key] = attrs
+	}
+
+	queue := funk.Keys(attrsByKey).([]string)
 
 process:
 	maxItems := int(math.Min(maxWriteOps, float64(len(queue))))
@@ -244,28 +351,18 @@ process:
 
 	mapOfAttrKeys := []*dynamodb.WriteRequest{}
 	for _, key := range next {
-		item, err := dynamodbattribute.MarshalMap(wfcache.CacheItem{
-			Key:       key,
-			Value:     pairs[key],
-			ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
-		})
-
-		if err != nil {
-			return err
-		}
-
 		mapOfAttrKeys = append(
 			mapOfAttrKeys,
 			&dynamodb.WriteRequest{
 				PutRequest: &dynamodb.PutRequest{
-					Item: item,
+					Item: attrsByKey[key],
 				},
 			},
 		)
 	}
 
 	var result *dynamodb.BatchWriteItemOutput
-	err := withRetry(ctx, func() error {
+	err := withRetry(ctx, s.logger, func() error {
 		var err error
 
 		result, err = s.dynamodbClient.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
@@ -289,6 +386,8 @@ process:
 			return *item.PutRequest.Item["key"].S
 		}).([]string)
 
+		s.logger.Info("dynamodb: requeuing unprocessed keys", "op", "BatchWriteItem", "keys", len(unprocessedKeys))
+
 		queue = append(queue, unprocessedKeys...)
 	}
 
@@ -316,7 +415,123 @@ func (s *DynamoDbStorage) Del(ctx context.Context, key string) error {
 	return nil
 }
 
-func withRetry(ctx aws.Context, fn func() error) (err error) {
+func (s *DynamoDbStorage) BatchDel(ctx context.Context, keys []string) error {
+	queue := keys
+
+process:
+	maxItems := int(math.Min(maxWriteOps, float64(len(queue))))
+	next := queue[0:maxItems]
+	queue = queue[maxItems:]
+
+	mapOfAttrKeys := []*dynamodb.WriteRequest{}
+	for _, key := range next {
+		mapOfAttrKeys = append(
+			mapOfAttrKeys,
+			&dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: map[string]*dynamodb.AttributeValue{
+						"key": {
+							S: aws.String(key),
+						},
+					},
+				},
+			},
+		)
+	}
+
+	var result *dynamodb.BatchWriteItemOutput
+	err := withRetry(ctx, s.logger, func() error {
+		var err error
+
+		result, err = s.dynamodbClient.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				s.tableName: mapOfAttrKeys,
+			},
+		})
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf(errDynamodbBatchWrite, err)
+	}
+
+	// if we have unprocessed items due to dynamodb limits,
+	// put them back in the queue
+	unprocessedItems := result.UnprocessedItems[s.tableName]
+
+	if unprocessedItems != nil {
+		unprocessedKeys := funk.Map(unprocessedItems, func(item *dynamodb.WriteRequest) string {
+			return *item.DeleteRequest.Key["key"].S
+		}).([]string)
+
+		s.logger.Info("dynamodb: requeuing unprocessed keys", "op", "BatchWriteItem", "keys", len(unprocessedKeys))
+
+		queue = append(queue, unprocessedKeys...)
+	}
+
+	if len(queue) != 0 {
+		goto process
+	}
+
+	return nil
+}
+
+func (s *DynamoDbStorage) BatchTouch(ctx context.Context, keys []string) error {
+	expiresAt := wfcache.ClampExpiry(0, s.ttl)
+	now := time.Now().UTC().Unix()
+
+	for _, key := range keys {
+		err := withRetry(ctx, s.logger, func() error {
+			_, err := s.dynamodbClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]*dynamodb.AttributeValue{
+					"key": {
+						S: aws.String(key),
+					},
+				},
+				// only unexpired items are touched, tombstones keep their expiry
+				ConditionExpression: aws.String("attribute_exists(#key) AND expiresAt > :now AND attribute_not_exists(absent)"),
+				UpdateExpression:    aws.String("SET expiresAt = :expiresAt, keepUntil = :expiresAt + if_not_exists(graceSeconds, :zero)"),
+				ExpressionAttributeNames: map[string]*string{
+					"#key": aws.String("key"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":expiresAt": {
+						N: aws.String(strconv.FormatInt(expiresAt, 10)),
+					},
+					":now": {
+						N: aws.String(strconv.FormatInt(now, 10)),
+					},
+					":zero": {
+						N: aws.String("0"),
+					},
+				},
+			})
+
+			return err
+		})
+
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func itemKey(item map[string]*dynamodb.AttributeValue) string {
+	if attr := item["key"]; attr != nil {
+		return aws.StringValue(attr.S)
+	}
+
+	return ""
+}
+
+func withRetry(ctx aws.Context, logger wfcache.Logger, fn func() error) (err error) {
 	var wait time.Duration
 
 	b := backoff.WithContext(backoff.NewExponentialBackOff(), ctx)
@@ -338,6 +553,8 @@ func withRetry(ctx aws.Context, fn func() error) (err error) {
 			return err
 		}
 
+		logger.Debug("dynamodb: retrying", "wait", wait, "err", err)
+
 		err = sleepWithContext(ctx, wait)
 		if err != nil {
 			return err
@@ -1,11 +1,13 @@
 package dynamodb_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"reflect"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -83,3 +85,48 @@ func TestDynamoDb(t *testing.T) {
 
 	fmt.Println(items, str, err)
 }
+
+func TestDynamoDbKeepsItemsForTheirGrace(t *testing.T) {
+	dynamodbClient := DynamodbClient()
+
+	storage, _ := dynamodbAdapter.Create(dynamodbClient, "tests", 6*time.Hour)()
+
+	ctx := context.Background()
+	expiresAt := time.Now().UTC().Add(-time.Minute).Unix()
+
+	storage.(wfcache.ItemStorage).SetItem(ctx, &wfcache.CacheItem{
+		Key:       "my_graced_key",
+		Value:     []byte(`"my_value"`),
+		ExpiresAt: expiresAt,
+		Grace:     time.Hour,
+	})
+
+	result, err := dynamodbClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("tests"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {
+				S: aws.String("my_graced_key"),
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the TTL of the table is on keepUntil
+	keepUntil := strconv.FormatInt(expiresAt+3600, 10)
+	if attr := result.Item["keepUntil"]; attr == nil || aws.StringValue(attr.N) != keepUntil {
+		t.Errorf("Received %v, expected keepUntil %v", attr, keepUntil)
+	}
+
+	if item, _ := wfcache.AsFetcher(storage).Fetch(ctx, "my_graced_key"); item != nil {
+		t.Errorf("Received %v, expected the expired item to be a miss", item)
+	}
+
+	items, err := storage.(wfcache.StaleFetcher).BatchFetchStale(ctx, []string{"my_graced_key"})
+
+	if err != nil || len(items) != 1 {
+		t.Errorf("Received %v (%v), expected the expired item within its grace", items, err)
+	}
+}
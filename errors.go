@@ -0,0 +1,112 @@
+package wfcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PartialError is returned by batch look ups that found only some of the keys.
+// Err is set when the keys are missing because of failing storages.
+type PartialError struct {
+	Missing []string
+	Err     error
+}
+
+func (e *PartialError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s, missing %d key(s): %s", ErrPartiallyFulfilled, len(e.Missing), e.Err)
+	}
+
+	return fmt.Sprintf("%s, missing %d key(s)", ErrPartiallyFulfilled, len(e.Missing))
+}
+
+func (e *PartialError) Is(target error) bool {
+	return target == ErrPartiallyFulfilled
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// LayerError reports the storage layer (by its index in the waterfall) and
+// the operation that failed.
+type LayerError struct {
+	Layer int
+	Name  string
+	Op    string
+	Keys  []string
+	Err   error
+}
+
+func (e *LayerError) Error() string {
+	return fmt.Sprintf("layer %d (%s) %s failed for %d key(s): %s", e.Layer, e.Name, e.Op, len(e.Keys), e.Err)
+}
+
+func (e *LayerError) Unwrap() error {
+	return e.Err
+}
+
+// LayerErrors aggregates the errors of an operation that failed on more than
+// one storage layer. errors.Is and errors.As match any of them.
+type LayerErrors []*LayerError
+
+func (e LayerErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e LayerErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (e LayerErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e LayerErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *LayerErrors) add(layer int, storage Storage, op string, keys []string, err error) {
+	*e = append(*e, &LayerError{
+		Layer: layer,
+		Name:  storageName(storage),
+		Op:    op,
+		Keys:  keys,
+		Err:   err,
+	})
+}
+
+// err returns nil, the only error, or all of them
+func (e LayerErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
@@ -31,20 +31,51 @@ func CreateWithConfig(capacity int, samples int, ttl time.Duration) wfcache.Stor
 	}
 }
 
+func (s *GoLRUStorage) Name() string {
+	return "golru"
+}
+
+func (s *GoLRUStorage) Local() bool {
+	return true
+}
+
 func (s *GoLRUStorage) TimeToLive() time.Duration {
 	return s.ttl
 }
 
 func (s *GoLRUStorage) Get(ctx context.Context, key string) *wfcache.CacheItem {
+	cacheItem, _ := s.Fetch(ctx, key)
+
+	return cacheItem
+}
+
+func (s *GoLRUStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	cacheItem, err := s.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheItem == nil || cacheItem.Expired() {
+		return nil, nil
+	}
+
+	return cacheItem, nil
+}
+
+// fetch reads the item whether it has expired or not
+func (s *GoLRUStorage) fetch(key string) (*wfcache.CacheItem, error) {
 	result := s.golru.Get(key)
+	if result == nil {
+		return nil, nil
+	}
 
 	cacheItem := wfcache.CacheItem{}
 	err := json.Unmarshal(result, &cacheItem)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	return &cacheItem
+	return &cacheItem, nil
 }
 
 func (s *GoLRUStorage) BatchGet(ctx context.Context, keys []string) (results []*wfcache.CacheItem) {
@@ -59,18 +90,57 @@ func (s *GoLRUStorage) BatchGet(ctx context.Context, keys []string) (results []*
 	return results
 }
 
+func (s *GoLRUStorage) BatchFetch(ctx context.Context, keys []string) (results []*wfcache.CacheItem, err error) {
+	for _, key := range keys {
+		m, fetchErr := s.Fetch(ctx, key)
+
+		if fetchErr != nil {
+			err = fetchErr
+			continue
+		}
+
+		if m != nil {
+			results = append(results, m)
+		}
+	}
+
+	return results, err
+}
+
+func (s *GoLRUStorage) BatchFetchStale(ctx context.Context, keys []string) (results []*wfcache.CacheItem, err error) {
+	for _, key := range keys {
+		m, fetchErr := s.fetch(key)
+
+		if fetchErr != nil {
+			err = fetchErr
+			continue
+		}
+
+		if m != nil && m.Kept() {
+			results = append(results, m)
+		}
+	}
+
+	return results, err
+}
+
 func (s *GoLRUStorage) Set(ctx context.Context, key string, data []byte) error {
-	item, err := json.Marshal(wfcache.CacheItem{
-		Key:       key,
-		Value:     data,
-		ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
+	return s.SetItem(ctx, &wfcache.CacheItem{
+		Key:   key,
+		Value: data,
 	})
+}
 
+func (s *GoLRUStorage) SetItem(ctx context.Context, cacheItem *wfcache.CacheItem) error {
+	item := *cacheItem
+	item.ExpiresAt = wfcache.ClampExpiry(item.ExpiresAt, s.ttl)
+
+	v, err := json.Marshal(item)
 	if err != nil {
 		return err
 	}
 
-	s.golru.Set(key, item)
+	s.golru.Set(item.Key, v)
 
 	return nil
 }
@@ -86,8 +156,49 @@ func (s *GoLRUStorage) BatchSet(ctx context.Context, pairs map[string][]byte) er
 	return nil
 }
 
+func (s *GoLRUStorage) BatchSetItems(ctx context.Context, cacheItems []*wfcache.CacheItem) error {
+	for _, cacheItem := range cacheItems {
+		err := s.SetItem(ctx, cacheItem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *GoLRUStorage) BatchTouch(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		cacheItem, err := s.Fetch(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if cacheItem == nil || cacheItem.Absent {
+			continue
+		}
+
+		cacheItem.ExpiresAt = 0
+
+		err = s.SetItem(ctx, cacheItem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *GoLRUStorage) Del(ctx context.Context, key string) error {
 	s.golru.Del(key)
 
 	return nil
 }
+
+func (s *GoLRUStorage) BatchDel(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		s.golru.Del(key)
+	}
+
+	return nil
+}
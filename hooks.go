@@ -0,0 +1,191 @@
+package wfcache
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks are called as the cache operates, e.g. to log or measure it. Any of
+// them can be left nil.
+type Hooks struct {
+	// OnStart is called when an operation, such as "Get", starts. Its storage
+	// layer calls and OnFinish get the returned context.
+	OnStart func(ctx context.Context, op string) context.Context
+
+	// OnLayerGet is called after a storage layer was read, with how many of
+	// the keys it had.
+	OnLayerGet func(ctx context.Context, layer int, keys []string, hits int, err error, took time.Duration)
+
+	// OnPrime is called after a storage layer was primed with keys found
+	// below it.
+	OnPrime func(ctx context.Context, layer int, keys []string, err error)
+
+	// OnSet is called after keys were set in a storage layer, including
+	// tombstones.
+	OnSet func(ctx context.Context, layer int, keys []string, err error)
+
+	// OnDel is called after keys were deleted from a storage layer.
+	OnDel func(ctx context.Context, layer int, keys []string, err error)
+
+	// OnTouch is called after the expiry of keys was reset in a storage layer.
+	OnTouch func(ctx context.Context, layer int, keys []string, err error)
+
+	// OnFinish is called when an operation finishes, with the error it
+	// returns.
+	OnFinish func(ctx context.Context, op string, err error)
+
+	// OnCircuitChange is called when the circuit breaker of a storage layer
+	// changes state (see Config.CircuitBreaker).
+	OnCircuitChange func(ctx context.Context, layer int, from CircuitState, to CircuitState)
+}
+
+type storageOpKey struct{}
+
+// storageOpHooks calls StartStorageOp and FinishStorageOp as operations start
+// and finish
+func storageOpHooks(sop StartStorageOp, fop FinishStorageOp) *Hooks {
+	return &Hooks{
+		OnStart: func(ctx context.Context, op string) context.Context {
+			return context.WithValue(ctx, storageOpKey{}, sop(ctx, op))
+		},
+		OnFinish: func(ctx context.Context, op string, err error) {
+			fop(ctx.Value(storageOpKey{}))
+		},
+	}
+}
+
+// start starts an operation of the cache, calling its hooks and tracer. The
+// operation's storage layer calls are made with the returned context, and
+// it's finished with the error it returns.
+func (c *Cache) start(ctx context.Context, opName string) (context.Context, func(*error)) {
+	ctx = c.withGenerations(ctx)
+
+	for _, hooks := range c.hooks {
+		if hooks.OnStart != nil {
+			ctx = hooks.OnStart(ctx, opName)
+		}
+	}
+
+	var end func(error)
+	if c.tracer != nil {
+		ctx, end = c.tracer.StartOperation(ctx, opName)
+	}
+
+	return ctx, func(err *error) {
+		if end != nil {
+			end(*err)
+		}
+
+		for i := len(c.hooks) - 1; i >= 0; i-- {
+			if c.hooks[i].OnFinish != nil {
+				c.hooks[i].OnFinish(ctx, opName, *err)
+			}
+		}
+	}
+}
+
+// layerCall tracks a call to a storage layer, into the stats, tracer and hooks
+// of the cache
+type layerCall struct {
+	c       *Cache
+	ctx     context.Context
+	storage Storage
+	call    LayerCall
+	start   time.Time
+	end     func(LayerCall)
+}
+
+func (c *Cache) startLayerCall(ctx context.Context, layer int, storage Storage, op string, keys []string) (context.Context, *layerCall) {
+	lc := &layerCall{
+		c:       c,
+		ctx:     ctx,
+		storage: storage,
+		call: LayerCall{
+			Layer: layer,
+			Op:    op,
+			Keys:  keys,
+		},
+	}
+
+	if c.tracer != nil {
+		lc.call.Name = storageName(storage)
+		ctx, lc.end = c.tracer.StartLayerCall(ctx, lc.call)
+	}
+
+	lc.start = time.Now()
+
+	return ctx, lc
+}
+
+func (lc *layerCall) finish(hits int, err error) time.Duration {
+	took := time.Since(lc.start)
+
+	if lc.end != nil {
+		lc.call.Hits = hits
+		lc.call.Err = err
+		lc.call.Took = took
+
+		lc.end(lc.call)
+	}
+
+	return took
+}
+
+func (lc *layerCall) got(hits int, misses int, err error) {
+	took := lc.finish(hits, err)
+	lc.c.stats.got(lc.call.Layer, lc.call.Op, hits, misses, err, took)
+
+	for _, hooks := range lc.c.hooks {
+		if hooks.OnLayerGet != nil {
+			hooks.OnLayerGet(lc.ctx, lc.call.Layer, lc.call.Keys, hits, err, took)
+		}
+	}
+}
+
+func (lc *layerCall) primed(cacheItems []*CacheItem, err error) {
+	took := lc.finish(0, err)
+	lc.c.stats.primed(lc.call.Layer, cacheItems, err, took)
+
+	if err != nil {
+		lc.c.logger.Warn("wfcache: failed to prime storage layer", "layer", lc.call.Layer, "storage", storageName(lc.storage), "keys", len(lc.call.Keys), "err", err)
+	}
+
+	for _, hooks := range lc.c.hooks {
+		if hooks.OnPrime != nil {
+			hooks.OnPrime(lc.ctx, lc.call.Layer, lc.call.Keys, err)
+		}
+	}
+}
+
+func (lc *layerCall) set(cacheItems []*CacheItem, err error) {
+	took := lc.finish(0, err)
+	lc.c.stats.set(lc.call.Layer, lc.call.Op, cacheItems, err, took)
+
+	for _, hooks := range lc.c.hooks {
+		if hooks.OnSet != nil {
+			hooks.OnSet(lc.ctx, lc.call.Layer, lc.call.Keys, err)
+		}
+	}
+}
+
+func (lc *layerCall) deleted(err error) {
+	took := lc.finish(0, err)
+	lc.c.stats.deleted(lc.call.Layer, lc.call.Op, len(lc.call.Keys), err, took)
+
+	for _, hooks := range lc.c.hooks {
+		if hooks.OnDel != nil {
+			hooks.OnDel(lc.ctx, lc.call.Layer, lc.call.Keys, err)
+		}
+	}
+}
+
+func (lc *layerCall) touched(err error) {
+	took := lc.finish(0, err)
+	lc.c.stats.called(lc.call.Layer, lc.call.Op, err, took)
+
+	for _, hooks := range lc.c.hooks {
+		if hooks.OnTouch != nil {
+			hooks.OnTouch(lc.ctx, lc.call.Layer, lc.call.Keys, err)
+		}
+	}
+}
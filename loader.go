@@ -0,0 +1,234 @@
+package wfcache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Loader resolves a key missed by every storage layer, typically from the
+// source database. Returning ErrNotFulfilled signals the key does not exist.
+type Loader func(ctx context.Context, key string) (interface{}, error)
+
+// BatchLoader resolves keys missed by every storage layer. Keys that do not
+// exist are left out of the returned map.
+type BatchLoader func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+func (c *Cache) GetOrLoad(ctx context.Context, key string, load Loader) (cacheItem *CacheItem, err error) {
+	storages, err := c.Storages()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, finish := c.start(ctx, "GetOrLoad")
+	defer finish(&err)
+
+	cacheItems, err := c.loads.do(ctx, []string{key}, func(ctx context.Context, keys []string) ([]*CacheItem, error) {
+		// misses caused by failing storages are loaded too
+		cacheItem, err := c.get(ctx, storages, key)
+		if err == nil {
+			return []*CacheItem{cacheItem}, nil
+		}
+
+		start := time.Now()
+
+		value, err := load(ctx, key)
+		if err == ErrNotFulfilled {
+			c.tombstone(ctx, storages, []string{key})
+			return nil, err
+		}
+
+		if err != nil {
+			return c.staleIfError(ctx, storages, []string{key}, err)
+		}
+
+		v, err := c.codec.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		cacheItem = c.newItem(key, v, 0)
+		cacheItem.Cost = time.Since(start)
+
+		// the loaded value is served even if layers fail to keep it, like
+		// when priming fails
+		err = c.set(ctx, storages, cacheItem)
+		if err != nil {
+			c.errorHandler(ctx, err)
+		}
+
+		return []*CacheItem{loaded(storages, cacheItem)}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.revalidate(ctx, storages, cacheItems, batchLoader(load))
+
+	return fulfilledOne(cacheItems)
+}
+
+func (c *Cache) BatchGetOrLoad(ctx context.Context, keys []string, load BatchLoader) (cacheItems []*CacheItem, err error) {
+	if hasDuplicates(keys) {
+		return nil, errors.New("duplicated keys are not allowed")
+	}
+
+	if hasEmptyString(keys) {
+		return nil, errors.New("empty keys are not allowed")
+	}
+
+	storages, err := c.Storages()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, finish := c.start(ctx, "BatchGetOrLoad")
+	defer finish(&err)
+
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+
+	cacheItems, err = c.loads.do(ctx, keys, func(ctx context.Context, keys []string) ([]*CacheItem, error) {
+		// misses caused by failing storages are loaded too
+		cacheItems, missingKeys, err := c.batchGet(ctx, storages, keys)
+		if err == nil {
+			return cacheItems, nil
+		}
+
+		loadedCacheItems, err := c.load(ctx, storages, missingKeys, load)
+		if err != nil {
+			staleCacheItems, err := c.staleIfError(ctx, storages, missingKeys, err)
+
+			return append(cacheItems, staleCacheItems...), err
+		}
+
+		return append(cacheItems, loadedCacheItems...), nil
+	})
+
+	c.revalidate(ctx, storages, cacheItems, load)
+
+	return fulfilled(keys, cacheItems, err)
+}
+
+// load writes the values of keys found by load to every storage layer
+func (c *Cache) load(ctx context.Context, storages []Storage, keys []string, load BatchLoader) ([]*CacheItem, error) {
+	start := time.Now()
+
+	values, err := load(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := time.Since(start)
+
+	cacheItems := []*CacheItem{}
+	missingKeys := []string{}
+	for _, key := range keys {
+		value, found := values[key]
+		if !found {
+			missingKeys = append(missingKeys, key)
+			continue
+		}
+
+		v, err := c.codec.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		cacheItem := c.newItem(key, v, 0)
+		cacheItem.Cost = cost
+
+		cacheItems = append(cacheItems, cacheItem)
+	}
+
+	if len(cacheItems) != 0 {
+		err = c.batchSet(ctx, storages, cacheItems)
+		if err != nil {
+			c.errorHandler(ctx, err)
+		}
+	}
+
+	c.tombstone(ctx, storages, missingKeys)
+
+	loadedCacheItems := make([]*CacheItem, 0, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		loadedCacheItems = append(loadedCacheItems, loaded(storages, cacheItem))
+	}
+
+	return loadedCacheItems, nil
+}
+
+// revalidate reloads the stale items, and those expiring early, in the
+// background. Keys already being refreshed are not refreshed again. Refreshes
+// have their own group so that GetOrLoad keeps serving the stale items from
+// the cache meanwhile, rather than waiting on them.
+func (c *Cache) revalidate(ctx context.Context, storages []Storage, cacheItems []*CacheItem, load BatchLoader) {
+	staleKeys := []string{}
+	for _, cacheItem := range cacheItems {
+		// expired items are only served when loading them fails
+		if (cacheItem.Stale() && !cacheItem.Expired()) || c.expiresEarly(cacheItem) {
+			staleKeys = append(staleKeys, cacheItem.Key)
+		}
+	}
+
+	if len(staleKeys) == 0 {
+		return
+	}
+
+	c.refreshes.start(ctx, staleKeys, func(ctx context.Context, keys []string) ([]*CacheItem, error) {
+		cacheItems, err := c.load(ctx, storages, keys, load)
+		if err != nil {
+			// nobody waits on a refresh to report its error to
+			c.errorHandler(ctx, err)
+		}
+
+		return cacheItems, err
+	})
+}
+
+// expiresEarly reports whether the item is treated as expired ahead of time,
+// which gets likelier as its expiry nears, the longer it took to load
+func (c *Cache) expiresEarly(cacheItem *CacheItem) bool {
+	if c.beta == 0 || cacheItem.ExpiresAt == 0 || cacheItem.Cost == 0 || cacheItem.Expired() {
+		return false
+	}
+
+	// -ln(u) for u in (0, 1] is exponentially distributed
+	gap := float64(cacheItem.Cost) * c.beta * -math.Log(1-rand.Float64())
+
+	return gap >= float64(time.Until(time.Unix(cacheItem.ExpiresAt, 0)))
+}
+
+// batchLoader loads keys one at a time with load
+func batchLoader(load Loader) BatchLoader {
+	return func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		values := map[string]interface{}{}
+
+		for _, key := range keys {
+			value, err := load(ctx, key)
+			if err == ErrNotFulfilled {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[key] = value
+		}
+
+		return values, nil
+	}
+}
+
+// loaded values are reported with the expiry of the top most storage layer
+func loaded(storages []Storage, cacheItem *CacheItem) *CacheItem {
+	item := *cacheItem
+	item.ExpiresAt = ClampExpiry(cacheItem.ExpiresAt, storages[0].TimeToLive())
+
+	return &item
+}
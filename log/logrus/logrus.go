@@ -0,0 +1,54 @@
+package logrus
+
+import (
+	"fmt"
+
+	"github.com/juliaqiuxy/wfcache"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is a wfcache.Logger writing to a logrus.FieldLogger, with the keys
+// and values logged as fields.
+type Logger struct {
+	logger logrus.FieldLogger
+}
+
+func New(logger logrus.FieldLogger) wfcache.Logger {
+	return &Logger{
+		logger: logger,
+	}
+}
+
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(fields(keysAndValues)).Debug(msg)
+}
+
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(fields(keysAndValues)).Info(msg)
+}
+
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(fields(keysAndValues)).Warn(msg)
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(fields(keysAndValues)).Error(msg)
+}
+
+func fields(keysAndValues []interface{}) logrus.Fields {
+	f := make(logrus.Fields, len(keysAndValues)/2)
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+
+		// a dangling value is kept rather than dropped, like slog does
+		if i+1 == len(keysAndValues) {
+			f["!BADKEY"] = key
+			break
+		}
+
+		f[key] = keysAndValues[i+1]
+	}
+
+	return f
+}
@@ -0,0 +1,36 @@
+//go:build go1.21
+
+package slog
+
+import (
+	"log/slog"
+
+	"github.com/juliaqiuxy/wfcache"
+)
+
+// Logger is a wfcache.Logger writing to a slog.Logger.
+type Logger struct {
+	logger *slog.Logger
+}
+
+func New(logger *slog.Logger) wfcache.Logger {
+	return &Logger{
+		logger: logger,
+	}
+}
+
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
@@ -0,0 +1,33 @@
+package zap
+
+import (
+	"github.com/juliaqiuxy/wfcache"
+	"go.uber.org/zap"
+)
+
+// Logger is a wfcache.Logger writing to a zap.Logger.
+type Logger struct {
+	logger *zap.SugaredLogger
+}
+
+func New(logger *zap.Logger) wfcache.Logger {
+	return &Logger{
+		logger: logger.Sugar(),
+	}
+}
+
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debugw(msg, keysAndValues...)
+}
+
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Infow(msg, keysAndValues...)
+}
+
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warnw(msg, keysAndValues...)
+}
+
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Errorw(msg, keysAndValues...)
+}
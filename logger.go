@@ -0,0 +1,32 @@
+package wfcache
+
+// Logger logs what the cache and its storages recover from without failing
+// an operation, e.g. retries or layers that could not be primed.
+// keysAndValues alternate keys and their values. See wfcache/log for
+// adapters of common loggers.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// NopLogger discards everything.
+type NopLogger struct{}
+
+func (NopLogger) Debug(msg string, keysAndValues ...interface{}) {}
+func (NopLogger) Info(msg string, keysAndValues ...interface{})  {}
+func (NopLogger) Warn(msg string, keysAndValues ...interface{})  {}
+func (NopLogger) Error(msg string, keysAndValues ...interface{}) {}
+
+// LoggerSetter is optionally implemented by storages and invalidation buses
+// that log, to be given the logger of the cache they're used by.
+type LoggerSetter interface {
+	SetLogger(logger Logger)
+}
+
+func setLogger(v interface{}, logger Logger) {
+	if s, ok := v.(LoggerSetter); ok {
+		s.SetLogger(logger)
+	}
+}
@@ -0,0 +1,583 @@
+package wfcache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespace maps the keys of a namespaced view to physical keys made of the
+// name and generation of the namespace, e.g. "team:1699999999999999999:key".
+type namespace struct {
+	cache *Cache
+	name  string
+}
+
+// Namespace returns a view of the cache whose keys are prefixed with name, so
+// that caches sharing storages don't collide. Its keys can all be invalidated
+// at once with BumpNamespace.
+func (c *Cache) Namespace(name string) *Cache {
+	ns := &namespace{
+		cache: c,
+		name:  name,
+	}
+
+	view := &Cache{
+		hooks: c.hooks,
+
+		codec:        c.codec,
+		errorHandler: c.errorHandler,
+
+		softTTL: c.softTTL,
+		loader:  c.loader,
+		grace:   c.grace,
+
+		negativeTTL:    c.negativeTTL,
+		negativeLayers: c.negativeLayers,
+
+		beta: c.beta,
+
+		id:  c.id,
+		bus: c.bus,
+
+		namespace: ns,
+
+		stats:  c.stats,
+		tracer: c.tracer,
+		logger: c.logger,
+	}
+
+	view.storages = Promise(func() (interface{}, error) {
+		storages, err := c.Storages()
+		if err != nil {
+			return nil, err
+		}
+
+		nsStorages := make([]Storage, 0, len(storages))
+		for _, storage := range storages {
+			nsStorages = append(nsStorages, ns.wrap(storage))
+		}
+
+		return nsStorages, nil
+	})
+
+	return view
+}
+
+// BumpNamespace invalidates every key of the namespace by moving it to a new
+// generation. Keys of previous generations are left to expire.
+func (c *Cache) BumpNamespace(ctx context.Context, name string) (err error) {
+	storages, err := c.Storages()
+	if err != nil {
+		return err
+	}
+
+	ctx, finish := c.start(ctx, "BumpNamespace")
+	defer finish(&err)
+
+	ns := &namespace{
+		cache: c,
+		name:  name,
+	}
+
+	cacheItem, _, err := ns.read(ctx, storages)
+	if err != nil {
+		return err
+	}
+
+	var generation int64
+	if cacheItem != nil {
+		generation, err = parseGeneration(cacheItem)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ns.write(ctx, storages, nextGeneration(generation))
+
+	return ns.cache.publish(ctx, []string{ns.generationKey()}, err)
+}
+
+// generations only ever increase, even when their item expired, so that keys
+// of a previous generation don't come back
+func nextGeneration(generation int64) int64 {
+	next := time.Now().UTC().UnixNano()
+	if next <= generation {
+		next = generation + 1
+	}
+
+	return next
+}
+
+func parseGeneration(cacheItem *CacheItem) (int64, error) {
+	return strconv.ParseInt(string(cacheItem.Value), 10, 64)
+}
+
+func (ns *namespace) generationKey() string {
+	return "wfcache:namespace:" + escapeNamespace(ns.name)
+}
+
+type generationKey struct {
+	ns *namespace
+}
+
+// resolvedGeneration is the generation of a namespace during an operation
+type resolvedGeneration struct {
+	mutex      sync.Mutex
+	resolved   bool
+	generation int64
+
+	// expiresAt is when the generation item read expires, in a layer with ttl
+	expiresAt int64
+	ttl       time.Duration
+	refreshed bool
+}
+
+// withGenerations has the generations of the namespaces of the cache resolved
+// once for the operation started with ctx
+func (c *Cache) withGenerations(ctx context.Context) context.Context {
+	for ns := c.namespace; ns != nil; ns = ns.cache.namespace {
+		ctx = context.WithValue(ctx, generationKey{ns}, &resolvedGeneration{})
+	}
+
+	return ctx
+}
+
+// generation returns the current generation of the namespace, starting one
+// if there is none. It's resolved once per operation, and isn't reported to
+// the stats, tracer and hooks of the cache.
+//
+// Layers give the generation item their own ttl. Were it to expire, keys would
+// be written to a new generation, and those of the previous one lost. Keys
+// can't outlive it since it's refreshed, once per second at most, before keys
+// are written to the namespace.
+func (ns *namespace) generation(ctx context.Context, write bool) (int64, error) {
+	rg, ok := ctx.Value(generationKey{ns}).(*resolvedGeneration)
+	if !ok {
+		rg = &resolvedGeneration{}
+	}
+
+	rg.mutex.Lock()
+	defer rg.mutex.Unlock()
+
+	storages, err := ns.cache.Storages()
+	if err != nil {
+		return 0, err
+	}
+
+	if !rg.resolved {
+		err = ns.resolve(ctx, storages, rg)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if write && !rg.refreshed {
+		rg.refreshed = true
+
+		refreshAt := ClampExpiry(0, rg.ttl)
+		if rg.expiresAt != 0 && (refreshAt == 0 || rg.expiresAt < refreshAt) {
+			// keys are written to the generation either way
+			if err := ns.refresh(ctx, storages, rg); err != nil {
+				ns.cache.errorHandler(ctx, err)
+			}
+		}
+	}
+
+	return rg.generation, nil
+}
+
+func (ns *namespace) resolve(ctx context.Context, storages []Storage, rg *resolvedGeneration) error {
+	cacheItem, layer, err := ns.read(ctx, storages)
+	if err != nil {
+		return err
+	}
+
+	if cacheItem == nil {
+		generation := nextGeneration(0)
+
+		err = ns.write(ctx, storages, generation)
+		err = ns.cache.publish(ctx, []string{ns.generationKey()}, err)
+		if err != nil {
+			return err
+		}
+
+		rg.resolved = true
+		rg.generation = generation
+		rg.refreshed = true
+
+		return nil
+	}
+
+	generation, err := parseGeneration(cacheItem)
+	if err != nil {
+		return err
+	}
+
+	rg.resolved = true
+	rg.generation = generation
+	rg.expiresAt = cacheItem.ExpiresAt
+	rg.ttl = storages[layer].TimeToLive()
+
+	return nil
+}
+
+// refresh touches the generation item in every layer, so that it lives as
+// long as keys written now. The generation resolved may come from a layer
+// another instance's bump didn't reach, so it's never written back. Instead,
+// the item is read again from the lowest layer, which instances share, and a
+// newer generation found there is adopted and primed in the layers above.
+func (ns *namespace) refresh(ctx context.Context, storages []Storage, rg *resolvedGeneration) error {
+	key := ns.generationKey()
+	last := len(storages) - 1
+
+	var errs LayerErrors
+
+	cacheItem, err := AsFetcher(storages[last]).Fetch(ctx, key)
+	if err != nil {
+		errs.add(last, storages[last], "Get", []string{key}, err)
+		return errs.err()
+	}
+
+	if cacheItem != nil {
+		generation, err := parseGeneration(cacheItem)
+		if err != nil {
+			return err
+		}
+
+		if generation > rg.generation {
+			rg.generation = generation
+
+			for i, storage := range storages[:last] {
+				err := setItem(ctx, storage, cacheItem)
+				if err != nil {
+					errs.add(i, storage, "Prime", []string{key}, err)
+				}
+			}
+		}
+	}
+
+	for i, storage := range storages {
+		err := batchTouch(ctx, storage, []string{key})
+		if err != nil {
+			errs.add(i, storage, "Touch", []string{key}, err)
+		}
+	}
+
+	return errs.err()
+}
+
+// read returns the generation item from the first layer that has it, and that
+// layer, priming those above. A layer failing may have it, so that's an error
+// when no other does.
+func (ns *namespace) read(ctx context.Context, storages []Storage) (*CacheItem, int, error) {
+	key := ns.generationKey()
+
+	var errs LayerErrors
+	missedLayers := []int{}
+
+	for i, storage := range storages {
+		cacheItem, err := AsFetcher(storage).Fetch(ctx, key)
+		if err != nil {
+			errs.add(i, storage, "Get", []string{key}, err)
+			continue
+		}
+
+		if cacheItem == nil {
+			missedLayers = append(missedLayers, i)
+			continue
+		}
+
+		for _, layer := range missedLayers {
+			err := setItem(ctx, storages[layer], cacheItem)
+			if err != nil {
+				errs.add(layer, storages[layer], "Prime", []string{key}, err)
+			}
+		}
+
+		if err := errs.err(); err != nil {
+			ns.cache.errorHandler(ctx, err)
+		}
+
+		return cacheItem, i, nil
+	}
+
+	return nil, -1, errs.err()
+}
+
+func (ns *namespace) write(ctx context.Context, storages []Storage, generation int64) error {
+	key := ns.generationKey()
+	cacheItem := &CacheItem{
+		Key:   key,
+		Value: []byte(strconv.FormatInt(generation, 10)),
+	}
+
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		err := setItem(ctx, storage, cacheItem)
+		if err != nil {
+			errs.add(i, storage, "Set", []string{key}, err)
+		}
+	}
+
+	return errs.err()
+}
+
+func (ns *namespace) prefix(generation int64) string {
+	return escapeNamespace(ns.name) + ":" + strconv.FormatInt(generation, 10) + ":"
+}
+
+// physicalKeys returns the keys of the current generation
+func (ns *namespace) physicalKeys(ctx context.Context, keys []string) ([]string, string, error) {
+	return ns.keys(ctx, keys, false)
+}
+
+// writtenKeys returns the keys of the current generation, keeping it from
+// expiring before keys written to it
+func (ns *namespace) writtenKeys(ctx context.Context, keys []string) ([]string, string, error) {
+	return ns.keys(ctx, keys, true)
+}
+
+func (ns *namespace) keys(ctx context.Context, keys []string, write bool) ([]string, string, error) {
+	generation, err := ns.generation(ctx, write)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := ns.prefix(generation)
+
+	physicalKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		physicalKeys = append(physicalKeys, prefix+key)
+	}
+
+	return physicalKeys, prefix, nil
+}
+
+// escapeNamespace keeps names from containing the separator
+func escapeNamespace(name string) string {
+	return strings.NewReplacer("%", "%25", ":", "%3A").Replace(name)
+}
+
+func (ns *namespace) wrap(storage Storage) Storage {
+	s := &nsStorage{
+		storageWrapper: storageWrapper{storage},
+		ns:             ns,
+	}
+
+	if _, _, indexer := tagIndexer([]Storage{storage}); indexer != nil {
+		return &nsTagStorage{nsStorage: s, indexer: indexer}
+	}
+
+	return s
+}
+
+// nsStorage reads and writes the keys of a namespace in a storage shared with
+// the rest of the cache
+type nsStorage struct {
+	storageWrapper
+
+	ns *namespace
+}
+
+func withKey(cacheItem *CacheItem, key string) *CacheItem {
+	item := *cacheItem
+	item.Key = key
+
+	return &item
+}
+
+func withoutPrefix(cacheItems []*CacheItem, prefix string) []*CacheItem {
+	logicalCacheItems := make([]*CacheItem, 0, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		logicalCacheItems = append(logicalCacheItems, withKey(cacheItem, strings.TrimPrefix(cacheItem.Key, prefix)))
+	}
+
+	return logicalCacheItems
+}
+
+func withPrefix(cacheItems []*CacheItem, prefix string) []*CacheItem {
+	physicalCacheItems := make([]*CacheItem, 0, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		physicalCacheItems = append(physicalCacheItems, withKey(cacheItem, prefix+cacheItem.Key))
+	}
+
+	return physicalCacheItems
+}
+
+func (s *nsStorage) Get(ctx context.Context, key string) *CacheItem {
+	cacheItem, _ := s.Fetch(ctx, key)
+
+	return cacheItem
+}
+
+func (s *nsStorage) BatchGet(ctx context.Context, keys []string) []*CacheItem {
+	cacheItems, _ := s.BatchFetch(ctx, keys)
+
+	return cacheItems
+}
+
+func (s *nsStorage) Fetch(ctx context.Context, key string) (*CacheItem, error) {
+	physicalKeys, prefix, err := s.ns.physicalKeys(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+
+	cacheItem, err := AsFetcher(s.storage).Fetch(ctx, physicalKeys[0])
+	if cacheItem == nil {
+		return nil, err
+	}
+
+	return withKey(cacheItem, strings.TrimPrefix(cacheItem.Key, prefix)), err
+}
+
+func (s *nsStorage) BatchFetch(ctx context.Context, keys []string) ([]*CacheItem, error) {
+	physicalKeys, prefix, err := s.ns.physicalKeys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheItems, err := AsFetcher(s.storage).BatchFetch(ctx, physicalKeys)
+
+	return withoutPrefix(cacheItems, prefix), err
+}
+
+func (s *nsStorage) BatchFetchStale(ctx context.Context, keys []string) ([]*CacheItem, error) {
+	physicalKeys, prefix, err := s.ns.physicalKeys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheItems, err := s.storageWrapper.BatchFetchStale(ctx, physicalKeys)
+
+	return withoutPrefix(cacheItems, prefix), err
+}
+
+func (s *nsStorage) Set(ctx context.Context, key string, value []byte) error {
+	physicalKeys, _, err := s.ns.writtenKeys(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+
+	return s.storage.Set(ctx, physicalKeys[0], value)
+}
+
+func (s *nsStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	_, prefix, err := s.ns.writtenKeys(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	physicalPairs := make(map[string][]byte, len(pairs))
+	for key, value := range pairs {
+		physicalPairs[prefix+key] = value
+	}
+
+	return s.storage.BatchSet(ctx, physicalPairs)
+}
+
+func (s *nsStorage) SetItem(ctx context.Context, cacheItem *CacheItem) error {
+	return s.BatchSetItems(ctx, []*CacheItem{cacheItem})
+}
+
+func (s *nsStorage) BatchSetItems(ctx context.Context, cacheItems []*CacheItem) error {
+	_, prefix, err := s.ns.writtenKeys(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	return batchSetItems(ctx, s.storage, withPrefix(cacheItems, prefix))
+}
+
+func (s *nsStorage) Del(ctx context.Context, key string) error {
+	return s.BatchDel(ctx, []string{key})
+}
+
+func (s *nsStorage) BatchDel(ctx context.Context, keys []string) error {
+	physicalKeys, _, err := s.ns.physicalKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	return batchDel(ctx, s.storage, physicalKeys)
+}
+
+func (s *nsStorage) BatchTouch(ctx context.Context, keys []string) error {
+	physicalKeys, _, err := s.ns.writtenKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	return batchTouch(ctx, s.storage, physicalKeys)
+}
+
+// nsTagStorage keeps the tags of a namespace apart from those of the rest of
+// the cache
+type nsTagStorage struct {
+	*nsStorage
+
+	indexer TagIndexer
+}
+
+func (s *nsTagStorage) tags(tags []string) []string {
+	nsTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		nsTags = append(nsTags, escapeNamespace(s.ns.name)+":"+tag)
+	}
+
+	return nsTags
+}
+
+func (s *nsTagStorage) TagKeys(ctx context.Context, key string, tags []string) error {
+	physicalKeys, _, err := s.ns.physicalKeys(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+
+	return s.indexer.TagKeys(ctx, physicalKeys[0], s.tags(tags))
+}
+
+func (s *nsTagStorage) TaggedKeys(ctx context.Context, tags []string) ([]string, error) {
+	_, prefix, err := s.ns.physicalKeys(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	physicalKeys, err := s.indexer.TaggedKeys(ctx, s.tags(tags))
+	if err != nil {
+		return nil, err
+	}
+
+	// keys of previous generations are already invalidated
+	keys := []string{}
+	for _, physicalKey := range physicalKeys {
+		if strings.HasPrefix(physicalKey, prefix) {
+			keys = append(keys, strings.TrimPrefix(physicalKey, prefix))
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *nsTagStorage) TagVersions(ctx context.Context, tags []string) (map[string]int64, error) {
+	nsVersions, err := s.indexer.TagVersions(ctx, s.tags(tags))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int64, len(nsVersions))
+	for i, nsTag := range s.tags(tags) {
+		if version, found := nsVersions[nsTag]; found {
+			versions[tags[i]] = version
+		}
+	}
+
+	return versions, nil
+}
+
+func (s *nsTagStorage) InvalidateTags(ctx context.Context, tags []string) error {
+	return s.indexer.InvalidateTags(ctx, s.tags(tags))
+}
@@ -0,0 +1,74 @@
+package otel
+
+import (
+	"context"
+	"errors"
+
+	"github.com/juliaqiuxy/wfcache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/juliaqiuxy/wfcache/otel"
+
+// Tracer traces the operations of a cache with a span each, and the storage
+// layer calls they make with child spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer makes a tracer creating spans with tracerProvider, to be set as
+// wfcache.Config.Tracer.
+func NewTracer(tracerProvider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer: tracerProvider.Tracer(instrumentationName),
+	}
+}
+
+func (t *Tracer) StartOperation(ctx context.Context, opName string) (context.Context, func(error)) {
+	ctx, span := t.tracer.Start(ctx, "wfcache."+opName,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("wfcache.op", opName),
+		),
+	)
+
+	return ctx, func(err error) {
+		// misses aren't failures
+		if err != nil && !errors.Is(err, wfcache.ErrNotFulfilled) && !errors.Is(err, wfcache.ErrPartiallyFulfilled) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+	}
+}
+
+func (t *Tracer) StartLayerCall(ctx context.Context, call wfcache.LayerCall) (context.Context, func(wfcache.LayerCall)) {
+	ctx, span := t.tracer.Start(ctx, "wfcache."+call.Name+"."+call.Op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int("wfcache.layer", call.Layer),
+			attribute.String("wfcache.layer.name", call.Name),
+			attribute.String("wfcache.op", call.Op),
+			attribute.Int("wfcache.keys", len(call.Keys)),
+		),
+	)
+
+	return ctx, func(call wfcache.LayerCall) {
+		switch call.Op {
+		case "Get", "BatchGet":
+			span.SetAttributes(attribute.Int("wfcache.hits", call.Hits))
+		case "Prime":
+			span.SetAttributes(attribute.Int("wfcache.primed_keys", len(call.Keys)))
+		}
+
+		if call.Err != nil {
+			span.RecordError(call.Err)
+			span.SetStatus(codes.Error, call.Err.Error())
+		}
+
+		span.End()
+	}
+}
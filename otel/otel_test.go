@@ -0,0 +1,163 @@
+package otel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/juliaqiuxy/wfcache"
+	basicAdapter "github.com/juliaqiuxy/wfcache/basic"
+	golruAdapter "github.com/juliaqiuxy/wfcache/golru"
+	otelTracer "github.com/juliaqiuxy/wfcache/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type failingStorage struct{}
+
+func (s failingStorage) TimeToLive() time.Duration { return time.Minute }
+
+func (s failingStorage) Get(ctx context.Context, key string) *wfcache.CacheItem { return nil }
+
+func (s failingStorage) BatchGet(ctx context.Context, keys []string) []*wfcache.CacheItem { return nil }
+
+func (s failingStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (s failingStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (s failingStorage) Set(ctx context.Context, key string, value []byte) error { return nil }
+
+func (s failingStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error { return nil }
+
+func (s failingStorage) Del(ctx context.Context, key string) error { return nil }
+
+func newCache(t *testing.T, makers ...wfcache.StorageMaker) (*wfcache.Cache, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	c, err := wfcache.NewWithConfig(
+		wfcache.Config{
+			Tracer: otelTracer.NewTracer(tracerProvider),
+		},
+		makers[0],
+		makers[1:]...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, exporter
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+
+	return attrs
+}
+
+func TestTracer(t *testing.T) {
+	c, exporter := newCache(t,
+		basicAdapter.Create(5*time.Minute),
+		golruAdapter.Create(100, 6*time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.Set("my_key", "my_value")
+	storages[0].Del(ctx, "my_key")
+	exporter.Reset()
+
+	c.GetWithContext(ctx, "my_key")
+
+	spans := exporter.GetSpans()
+
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+
+	// spans are exported as they end
+	expected := []string{"wfcache.basic.Get", "wfcache.golru.Get", "wfcache.basic.Prime", "wfcache.Get"}
+
+	if len(names) != len(expected) {
+		t.Fatalf("Received %v, expected %v", names, expected)
+	}
+
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Received %v, expected %v", names, expected)
+		}
+	}
+
+	parent := spans[3]
+
+	for _, span := range spans[:3] {
+		if span.Parent.SpanID() != parent.SpanContext.SpanID() {
+			t.Errorf("Expected %v to be a child of %v", span.Name, parent.Name)
+		}
+
+		attrs := attributes(span)
+
+		if attrs["wfcache.keys"].AsInt64() != 1 {
+			t.Errorf("Received %v, expected %v to be called with 1 key", attrs["wfcache.keys"].AsInt64(), span.Name)
+		}
+	}
+
+	if attrs := attributes(spans[0]); attrs["wfcache.hits"].AsInt64() != 0 || attrs["wfcache.layer"].AsInt64() != 0 || attrs["wfcache.layer.name"].AsString() != "basic" {
+		t.Errorf("Received %v, expected a miss on the first layer", attrs)
+	}
+
+	if attrs := attributes(spans[1]); attrs["wfcache.hits"].AsInt64() != 1 || attrs["wfcache.layer"].AsInt64() != 1 {
+		t.Errorf("Received %v, expected a hit on the second layer", attrs)
+	}
+
+	if attrs := attributes(spans[2]); attrs["wfcache.primed_keys"].AsInt64() != 1 {
+		t.Errorf("Received %v, expected the first layer to be primed", attrs)
+	}
+}
+
+func TestTracerErrors(t *testing.T) {
+	c, exporter := newCache(t,
+		func() (wfcache.Storage, error) {
+			return failingStorage{}, nil
+		},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	c.BatchGet([]string{"my_key1", "my_key2"})
+
+	spans := exporter.GetSpans()
+
+	if len(spans) != 3 {
+		t.Fatalf("Received %v spans, expected 3", len(spans))
+	}
+
+	failed := spans[0]
+
+	if failed.Status.Code != codes.Error || len(failed.Events) != 1 || failed.Events[0].Name != "exception" {
+		t.Errorf("Received %+v, expected the error to be recorded", failed.Status)
+	}
+
+	if attrs := attributes(failed); attrs["wfcache.keys"].AsInt64() != 2 || attrs["wfcache.op"].AsString() != "BatchGet" {
+		t.Errorf("Received %v, expected a BatchGet of 2 keys", attrs)
+	}
+
+	if spans[1].Status.Code == codes.Error {
+		t.Errorf("Expected the second layer not to fail")
+	}
+
+	if spans[2].Name != "wfcache.BatchGet" || spans[2].Status.Code != codes.Error {
+		t.Errorf("Received %v (%+v), expected the operation to fail", spans[2].Name, spans[2].Status)
+	}
+}
@@ -0,0 +1,114 @@
+package wfcache
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// TTLPolicy decides how long a storage layer keeps an item that was written
+// without an explicit expiry. A duration <= 0 falls back to the layer's ttl.
+type TTLPolicy func(key string, value []byte) time.Duration
+
+type TTLConfig struct {
+	// Policy picks the lifetime of each item. Defaults to the layer's ttl.
+	Policy TTLPolicy
+
+	// Jitter randomly shortens or lengthens lifetimes by up to this fraction,
+	// e.g. 0.1 for ±10%, so that items written together don't expire together.
+	// Lifetimes are jittered around the ttl shortened by the same fraction,
+	// since the layer's ttl caps them. It's at most 0.5.
+	Jitter float64
+}
+
+// WithTTLConfig makes the storage created by maker pick the expiry of items
+// written without one with conf. The storage's own ttl still caps it. Storages
+// that don't implement ItemStorage can't be given an expiry, and keep items
+// for their own ttl.
+func WithTTLConfig(maker StorageMaker, conf TTLConfig) StorageMaker {
+	return func() (Storage, error) {
+		storage, err := maker()
+		if err != nil {
+			return nil, err
+		}
+
+		jitter := math.Min(math.Max(conf.Jitter, 0), 0.5)
+
+		return &ttlStorage{
+			storageWrapper: storageWrapper{storage},
+			policy:         conf.Policy,
+			jitter:         jitter,
+		}, nil
+	}
+}
+
+type ttlStorage struct {
+	storageWrapper
+
+	policy TTLPolicy
+	jitter float64
+}
+
+func (s *ttlStorage) Set(ctx context.Context, key string, value []byte) error {
+	return s.SetItem(ctx, &CacheItem{
+		Key:   key,
+		Value: value,
+	})
+}
+
+func (s *ttlStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	cacheItems := make([]*CacheItem, 0, len(pairs))
+	for key, value := range pairs {
+		cacheItems = append(cacheItems, &CacheItem{
+			Key:   key,
+			Value: value,
+		})
+	}
+
+	return s.BatchSetItems(ctx, cacheItems)
+}
+
+func (s *ttlStorage) SetItem(ctx context.Context, cacheItem *CacheItem) error {
+	return setItem(ctx, s.storage, s.expiring(cacheItem))
+}
+
+func (s *ttlStorage) BatchSetItems(ctx context.Context, cacheItems []*CacheItem) error {
+	expiringCacheItems := make([]*CacheItem, 0, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		expiringCacheItems = append(expiringCacheItems, s.expiring(cacheItem))
+	}
+
+	return batchSetItems(ctx, s.storage, expiringCacheItems)
+}
+
+// expiring returns a copy of the item with its expiry picked by the policy,
+// unless it already has one
+func (s *ttlStorage) expiring(cacheItem *CacheItem) *CacheItem {
+	if cacheItem.ExpiresAt != 0 {
+		return cacheItem
+	}
+
+	var ttl time.Duration
+	if s.policy != nil {
+		ttl = s.policy(cacheItem.Key, cacheItem.Value)
+	}
+
+	if ttl <= 0 {
+		ttl = s.storage.TimeToLive()
+	}
+
+	if ttl <= 0 {
+		return cacheItem
+	}
+
+	// ttl*(1-jitter) ± ttl*jitter never exceeds ttl
+	if s.jitter != 0 {
+		ttl = time.Duration(float64(ttl) * (1 - s.jitter + s.jitter*(2*rand.Float64()-1)))
+	}
+
+	item := *cacheItem
+	item.ExpiresAt = time.Now().UTC().Add(ttl).Unix()
+
+	return &item
+}
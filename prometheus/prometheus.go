@@ -0,0 +1,122 @@
+package prometheus
+
+import (
+	"strconv"
+
+	"github.com/juliaqiuxy/wfcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector exports the stats of the storage layers of a cache, read from
+// Cache.Stats when scraped.
+type Collector struct {
+	cache *wfcache.Cache
+
+	hits    *prometheus.Desc
+	misses  *prometheus.Desc
+	primes  *prometheus.Desc
+	sets    *prometheus.Desc
+	deletes *prometheus.Desc
+	errors  *prometheus.Desc
+
+	latency *prometheus.Desc
+	sizes   *prometheus.Desc
+}
+
+var layerLabels = []string{"layer", "storage"}
+
+// NewCollector makes a collector of the stats of c. labels, if any, tell the
+// metrics of several caches apart.
+func NewCollector(c *wfcache.Cache, labels prometheus.Labels) *Collector {
+	desc := func(name string, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName("wfcache", "layer", name),
+			help,
+			append(append([]string{}, layerLabels...), variableLabels...),
+			labels,
+		)
+	}
+
+	return &Collector{
+		cache: c,
+
+		hits:    desc("hits_total", "Keys read from the storage layer that it had."),
+		misses:  desc("misses_total", "Keys read from the storage layer that it didn't have."),
+		primes:  desc("primes_total", "Keys primed in the storage layer after a hit below it."),
+		sets:    desc("sets_total", "Keys set in the storage layer."),
+		deletes: desc("deletes_total", "Keys deleted from the storage layer."),
+		errors:  desc("errors_total", "Failed calls to the storage layer."),
+
+		latency: desc("operation_duration_seconds", "Duration of the calls to the storage layer by operation.", "op"),
+		sizes:   desc("item_size_bytes", "Size of the values of the items set and primed in the storage layer."),
+	}
+}
+
+// Register registers a collector of the stats of c with registerer.
+func Register(registerer prometheus.Registerer, c *wfcache.Cache, labels prometheus.Labels) error {
+	return registerer.Register(NewCollector(c, labels))
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.primes
+	ch <- c.sets
+	ch <- c.deletes
+	ch <- c.errors
+	ch <- c.latency
+	ch <- c.sizes
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.cache.Stats()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.hits, err)
+		return
+	}
+
+	for _, layer := range stats.Layers {
+		labels := []string{strconv.Itoa(layer.Layer), layer.Name}
+
+		counter := func(desc *prometheus.Desc, value uint64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), labels...)
+		}
+
+		counter(c.hits, layer.Hits)
+		counter(c.misses, layer.Misses)
+		counter(c.primes, layer.Primes)
+		counter(c.sets, layer.Sets)
+		counter(c.deletes, layer.Deletes)
+		counter(c.errors, layer.Errors)
+
+		for op, h := range layer.Latency {
+			bounds := make([]float64, 0, len(h.Buckets))
+			for _, bucket := range h.Buckets {
+				bounds = append(bounds, bucket.Seconds())
+			}
+
+			ch <- prometheus.MustNewConstHistogram(c.latency, h.Count, h.Sum.Seconds(), buckets(bounds, h.Counts), append(labels, op)...)
+		}
+
+		bounds := make([]float64, 0, len(layer.Sizes.Buckets))
+		for _, bucket := range layer.Sizes.Buckets {
+			bounds = append(bounds, float64(bucket))
+		}
+
+		ch <- prometheus.MustNewConstHistogram(c.sizes, layer.Sizes.Count, float64(layer.Sizes.Sum), buckets(bounds, layer.Sizes.Counts), labels...)
+	}
+}
+
+// buckets makes the cumulative counts prometheus expects of the counts by
+// bucket of wfcache, leaving out the count above the last bound
+func buckets(bounds []float64, counts []uint64) map[float64]uint64 {
+	cumulative := make(map[float64]uint64, len(bounds))
+
+	var count uint64
+	for i, bound := range bounds {
+		count += counts[i]
+		cumulative[bound] = count
+	}
+
+	return cumulative
+}
@@ -0,0 +1,109 @@
+package prometheus_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliaqiuxy/wfcache"
+	basicAdapter "github.com/juliaqiuxy/wfcache/basic"
+	golruAdapter "github.com/juliaqiuxy/wfcache/golru"
+	prometheusExporter "github.com/juliaqiuxy/wfcache/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5*time.Minute),
+		golruAdapter.Create(100, 6*time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.Set("my_key", "my_value")
+	storages[0].Del(ctx, "my_key")
+
+	c.Get("my_key")
+	c.Get("my_missing_key")
+	c.Del("my_key")
+
+	registry := prometheus.NewPedanticRegistry()
+
+	err := prometheusExporter.Register(registry, c, prometheus.Labels{"cache": "my_cache"})
+	if err != nil {
+		t.Fatalf("Received %v, expected the collector to be registered", err)
+	}
+
+	expected := `
+# HELP wfcache_layer_deletes_total Keys deleted from the storage layer.
+# TYPE wfcache_layer_deletes_total counter
+wfcache_layer_deletes_total{cache="my_cache",layer="0",storage="basic"} 1
+wfcache_layer_deletes_total{cache="my_cache",layer="1",storage="golru"} 1
+# HELP wfcache_layer_errors_total Failed calls to the storage layer.
+# TYPE wfcache_layer_errors_total counter
+wfcache_layer_errors_total{cache="my_cache",layer="0",storage="basic"} 0
+wfcache_layer_errors_total{cache="my_cache",layer="1",storage="golru"} 0
+# HELP wfcache_layer_hits_total Keys read from the storage layer that it had.
+# TYPE wfcache_layer_hits_total counter
+wfcache_layer_hits_total{cache="my_cache",layer="0",storage="basic"} 0
+wfcache_layer_hits_total{cache="my_cache",layer="1",storage="golru"} 1
+# HELP wfcache_layer_misses_total Keys read from the storage layer that it didn't have.
+# TYPE wfcache_layer_misses_total counter
+wfcache_layer_misses_total{cache="my_cache",layer="0",storage="basic"} 2
+wfcache_layer_misses_total{cache="my_cache",layer="1",storage="golru"} 1
+# HELP wfcache_layer_primes_total Keys primed in the storage layer after a hit below it.
+# TYPE wfcache_layer_primes_total counter
+wfcache_layer_primes_total{cache="my_cache",layer="0",storage="basic"} 1
+wfcache_layer_primes_total{cache="my_cache",layer="1",storage="golru"} 0
+# HELP wfcache_layer_sets_total Keys set in the storage layer.
+# TYPE wfcache_layer_sets_total counter
+wfcache_layer_sets_total{cache="my_cache",layer="0",storage="basic"} 1
+wfcache_layer_sets_total{cache="my_cache",layer="1",storage="golru"} 1
+# HELP wfcache_layer_item_size_bytes Size of the values of the items set and primed in the storage layer.
+# TYPE wfcache_layer_item_size_bytes histogram
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="64"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="256"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="1024"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="4096"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="16384"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="65536"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="262144"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="1.048576e+06"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="0",storage="basic",le="+Inf"} 2
+wfcache_layer_item_size_bytes_sum{cache="my_cache",layer="0",storage="basic"} 20
+wfcache_layer_item_size_bytes_count{cache="my_cache",layer="0",storage="basic"} 2
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="64"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="256"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="1024"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="4096"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="16384"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="65536"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="262144"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="1.048576e+06"} 1
+wfcache_layer_item_size_bytes_bucket{cache="my_cache",layer="1",storage="golru",le="+Inf"} 1
+wfcache_layer_item_size_bytes_sum{cache="my_cache",layer="1",storage="golru"} 10
+wfcache_layer_item_size_bytes_count{cache="my_cache",layer="1",storage="golru"} 1
+`
+
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"wfcache_layer_hits_total",
+		"wfcache_layer_misses_total",
+		"wfcache_layer_primes_total",
+		"wfcache_layer_sets_total",
+		"wfcache_layer_deletes_total",
+		"wfcache_layer_errors_total",
+		"wfcache_layer_item_size_bytes",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Set, Get and Del on both layers, and Prime on the first
+	count, err := testutil.GatherAndCount(registry, "wfcache_layer_operation_duration_seconds")
+	if err != nil || count != 7 {
+		t.Errorf("Received %v (%v), expected 7 operation histograms", count, err)
+	}
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/juliaqiuxy/wfcache"
+)
+
+// RedisBus is a wfcache.InvalidationBus over a redis pub/sub channel.
+type RedisBus struct {
+	redisClient *redis.Client
+	channel     string
+	logger      wfcache.Logger
+}
+
+func NewBus(redisClient *redis.Client, channel string) *RedisBus {
+	return &RedisBus{
+		redisClient: redisClient,
+		channel:     channel,
+		logger:      wfcache.NopLogger{},
+	}
+}
+
+func (b *RedisBus) SetLogger(logger wfcache.Logger) {
+	b.logger = logger
+}
+
+func (b *RedisBus) Publish(ctx context.Context, invalidation *wfcache.Invalidation) error {
+	v, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+
+	return b.redisClient.Publish(ctx, b.channel, v).Err()
+}
+
+func (b *RedisBus) Subscribe(handler func(invalidation *wfcache.Invalidation)) (func() error, error) {
+	ctx := context.Background()
+
+	pubsub := b.redisClient.Subscribe(ctx, b.channel)
+
+	// wait for the subscription, so that no invalidation published after
+	// Subscribe returns is missed
+	_, err := pubsub.Receive(ctx)
+	if err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	logger := b.logger
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			invalidation := wfcache.Invalidation{}
+
+			err := json.Unmarshal([]byte(msg.Payload), &invalidation)
+			if err != nil {
+				logger.Warn("redis: failed to unmarshal invalidation", "channel", msg.Channel, "err", err)
+				continue
+			}
+
+			handler(&invalidation)
+		}
+	}()
+
+	return pubsub.Close, nil
+}
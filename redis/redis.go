@@ -9,12 +9,12 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	"github.com/go-redis/redis/v8"
 	"github.com/juliaqiuxy/wfcache"
-	"github.com/thoas/go-funk"
 )
 
 type RedisStorage struct {
 	redisClient *redis.Client
 	ttl         time.Duration
+	logger      wfcache.Logger
 }
 
 const maxReadOps = 200
@@ -25,34 +25,86 @@ func Create(redisClient *redis.Client, ttl time.Duration) wfcache.StorageMaker {
 		s := &RedisStorage{
 			redisClient: redisClient,
 			ttl:         ttl,
+			logger:      wfcache.NopLogger{},
 		}
 
 		return s, nil
 	}
 }
 
+func (s *RedisStorage) Name() string {
+	return "redis"
+}
+
+func (s *RedisStorage) SetLogger(logger wfcache.Logger) {
+	s.logger = logger
+}
+
 func (s *RedisStorage) TimeToLive() time.Duration {
 	return s.ttl
 }
 
 func (s *RedisStorage) Get(ctx context.Context, key string) *wfcache.CacheItem {
-	result, err := s.redisClient.Get(ctx, key).Bytes()
+	cacheItem, err := s.Fetch(ctx, key)
 
 	if err != nil {
+		s.logger.Warn("redis: failed to get key", "key", key, "err", err)
 		return nil
 	}
 
+	return cacheItem
+}
+
+func (s *RedisStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	result, err := s.redisClient.Get(ctx, key).Bytes()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
 	cacheItem := wfcache.CacheItem{}
 	err = json.Unmarshal(result, &cacheItem)
 
 	if err != nil {
-		return nil
+		return nil, err
+	}
+
+	if cacheItem.Expired() {
+		return nil, nil
 	}
 
-	return &cacheItem
+	return &cacheItem, nil
 }
 
-func (s *RedisStorage) BatchGet(ctx context.Context, keys []string) (results []*wfcache.CacheItem) {
+func (s *RedisStorage) BatchGet(ctx context.Context, keys []string) []*wfcache.CacheItem {
+	results, err := s.BatchFetch(ctx, keys)
+
+	if err != nil {
+		s.logger.Warn("redis: failed to get keys", "keys", len(keys), "err", err)
+	}
+
+	return results
+}
+
+func (s *RedisStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return s.batchFetch(ctx, keys, func(cacheItem *wfcache.CacheItem) bool {
+		return !cacheItem.Expired()
+	})
+}
+
+func (s *RedisStorage) BatchFetchStale(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return s.batchFetch(ctx, keys, func(cacheItem *wfcache.CacheItem) bool {
+		return cacheItem.Kept()
+	})
+}
+
+func (s *RedisStorage) batchFetch(ctx context.Context, keys []string, keep func(*wfcache.CacheItem) bool) (results []*wfcache.CacheItem, err error) {
+	var unmarshalErr error
+
 	queue := keys
 
 process:
@@ -61,7 +113,7 @@ process:
 	queue = queue[maxItems:]
 
 	var items []interface{}
-	err := withRetry(ctx, func() error {
+	err = withRetry(ctx, s.logger, func() error {
 		var err error
 
 		items, err = s.redisClient.MGet(ctx, next...).Result()
@@ -70,21 +122,24 @@ process:
 	})
 
 	if err != nil {
-		// TODO(juliaqiuxy) log debug
-		return nil
+		return results, err
 	}
 
-	for _, item := range items {
+	for i, item := range items {
 		if item != nil {
 			cacheItem := wfcache.CacheItem{}
 			err = json.Unmarshal([]byte(item.(string)), &cacheItem)
 
+			// an item that can't be read is not a miss
 			if err != nil {
-				// TODO(juliaqiuxy) log debug
-				return nil
+				s.logger.Warn("redis: failed to unmarshal item", "key", next[i], "err", err)
+				unmarshalErr = err
+				continue
 			}
 
-			results = append(results, &cacheItem)
+			if keep(&cacheItem) {
+				results = append(results, &cacheItem)
+			}
 		}
 	}
 
@@ -92,21 +147,26 @@ process:
 		goto process
 	}
 
-	return results
+	return results, unmarshalErr
 }
 
 func (s *RedisStorage) Set(ctx context.Context, key string, data []byte) error {
-	item, err := json.Marshal(wfcache.CacheItem{
-		Key:       key,
-		Value:     data,
-		ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
+	return s.SetItem(ctx, &wfcache.CacheItem{
+		Key:   key,
+		Value: data,
 	})
+}
+
+func (s *RedisStorage) SetItem(ctx context.Context, cacheItem *wfcache.CacheItem) error {
+	item := *cacheItem
+	item.ExpiresAt = wfcache.ClampExpiry(item.ExpiresAt, s.ttl)
 
+	v, err := json.Marshal(item)
 	if err != nil {
 		return err
 	}
 
-	err = s.redisClient.Set(ctx, key, item, s.ttl).Err()
+	err = s.redisClient.Set(ctx, item.Key, v, expiration(item.KeepUntil())).Err()
 	if err != nil {
 		return err
 	}
@@ -115,32 +175,50 @@ func (s *RedisStorage) Set(ctx context.Context, key string, data []byte) error {
 }
 
 func (s *RedisStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
-	queue := funk.Keys(pairs).([]string)
+	cacheItems := make([]*wfcache.CacheItem, 0, len(pairs))
+	for key, data := range pairs {
+		cacheItems = append(cacheItems, &wfcache.CacheItem{
+			Key:   key,
+			Value: data,
+		})
+	}
+
+	return s.BatchSetItems(ctx, cacheItems)
+}
+
+func (s *RedisStorage) BatchSetItems(ctx context.Context, cacheItems []*wfcache.CacheItem) error {
+	queue := cacheItems
 
 process:
 	maxItems := int(math.Min(maxWriteOps, float64(len(queue))))
 	next := queue[0:maxItems]
 	queue = queue[maxItems:]
 
-	nextPairs := funk.Reduce(next, func(acc map[string]interface{}, key string) map[string]interface{} {
-		item, _ := json.Marshal(wfcache.CacheItem{
-			Key:       key,
-			Value:     pairs[key],
-			ExpiresAt: time.Now().UTC().Add(s.ttl).Unix(),
-		})
-		acc[key] = item
+	nextPairs := map[string]interface{}{}
+	nextExpiresAt := map[string]int64{}
+	for _, cacheItem := range next {
+		item := *cacheItem
+		item.ExpiresAt = wfcache.ClampExpiry(item.ExpiresAt, s.ttl)
 
-		return acc
-	}, map[string]interface{}{})
+		v, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		nextPairs[item.Key] = v
+		nextExpiresAt[item.Key] = item.KeepUntil()
+	}
 
-	err := withRetry(ctx, func() error {
+	err := withRetry(ctx, s.logger, func() error {
 		pipe := s.redisClient.TxPipeline()
 
 		// MSet doesn't support TTL. So try to do it all in a round-trip
-		pipe.MSet(ctx, nextPairs.(map[string]interface{}))
+		pipe.MSet(ctx, nextPairs)
 
-		for _, key := range next {
-			pipe.Expire(ctx, key, s.ttl)
+		for key, expiresAt := range nextExpiresAt {
+			if expiresAt != 0 {
+				pipe.ExpireAt(ctx, key, time.Unix(expiresAt, 0))
+			}
 		}
 
 		_, err := pipe.Exec(ctx)
@@ -173,7 +251,74 @@ func (s *RedisStorage) BatchDel(ctx context.Context, keys []string) error {
 	return nil
 }
 
-func withRetry(ctx context.Context, fn func() error) (err error) {
+// touchScript moves the expiry of the kept, unexpired, items to ARGV[1]. The
+// expiry is part of the stored item, so it's replaced in place server side.
+var touchScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	local v = redis.call('GET', key)
+
+	if v and not string.find(v, '"absent":true', 1, true) then
+		local expiresAt = tonumber(string.match(v, '"expiresAt":(%d+)'))
+
+		if expiresAt and expiresAt > tonumber(ARGV[2]) then
+			local grace = tonumber(string.match(v, '"grace":(%d+)') or '0')
+
+			v = string.gsub(v, '"expiresAt":%d+', '"expiresAt":' .. ARGV[1], 1)
+
+			redis.call('SET', key, v)
+			redis.call('EXPIREAT', key, tonumber(ARGV[1]) + math.floor(grace / 1e9))
+		end
+	end
+end
+
+return 0
+`)
+
+func (s *RedisStorage) BatchTouch(ctx context.Context, keys []string) error {
+	if s.ttl <= 0 {
+		return nil
+	}
+
+	queue := keys
+
+process:
+	maxItems := int(math.Min(maxWriteOps, float64(len(queue))))
+	next := queue[0:maxItems]
+	queue = queue[maxItems:]
+
+	err := withRetry(ctx, s.logger, func() error {
+		return touchScript.Run(ctx, s.redisClient, next, wfcache.ClampExpiry(0, s.ttl), time.Now().UTC().Unix()).Err()
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(queue) != 0 {
+		goto process
+	}
+
+	return nil
+}
+
+// expiration converts the time until which an item is kept to a redis key
+// expiration where 0 means the key does not expire
+func expiration(keepUntil int64) time.Duration {
+	if keepUntil == 0 {
+		return 0
+	}
+
+	ttl := time.Until(time.Unix(keepUntil, 0))
+
+	// an already expired item still overwrites the key, but only briefly
+	if ttl < time.Millisecond {
+		return time.Millisecond
+	}
+
+	return ttl
+}
+
+func withRetry(ctx context.Context, logger wfcache.Logger, fn func() error) (err error) {
 	var wait time.Duration
 
 	b := backoff.WithContext(backoff.NewExponentialBackOff(), ctx)
@@ -195,6 +340,8 @@ func withRetry(ctx context.Context, fn func() error) (err error) {
 			return err
 		}
 
+		logger.Debug("redis: retrying", "wait", wait, "err", err)
+
 		err = sleepWithContext(ctx, wait)
 		if err != nil {
 			return err
@@ -81,3 +81,136 @@ func TestRedis(t *testing.T) {
 
 	fmt.Println(items, str, err)
 }
+
+func TestRedisBatchTouch(t *testing.T) {
+	r := RedisClient()
+	ctx := context.Background()
+
+	storage, _ := redisAdapter.Create(r, 6*time.Hour)()
+	s := storage.(*redisAdapter.RedisStorage)
+
+	s.SetItem(ctx, &wfcache.CacheItem{
+		Key:       "my_touch_key",
+		Value:     []byte(`"my_value"`),
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		Grace:     time.Hour,
+	})
+
+	err := s.BatchTouch(ctx, []string{"my_touch_key"})
+
+	if err != nil {
+		t.Fatalf("Received %v, expected my_touch_key to be touched", err)
+	}
+
+	item, _ := s.Fetch(ctx, "my_touch_key")
+
+	if item == nil || time.Until(time.Unix(item.ExpiresAt, 0)) < 5*time.Hour || string(item.Value) != `"my_value"` {
+		t.Errorf("Expected my_touch_key to expire in 6 hours, got %v", item)
+	}
+
+	if ttl := r.TTL(ctx, "my_touch_key").Val(); ttl < 6*time.Hour {
+		t.Errorf("Expected the key to be kept for 6 hours plus grace, got %v", ttl)
+	}
+}
+
+func TestRedisBus(t *testing.T) {
+	r := RedisClient()
+
+	bus := redisAdapter.NewBus(r, "wfcache-test-invalidations")
+
+	received := make(chan *wfcache.Invalidation, 1)
+
+	unsubscribe, err := bus.Subscribe(func(invalidation *wfcache.Invalidation) {
+		received <- invalidation
+	})
+
+	if err != nil {
+		t.Fatalf("Received %v, expected to subscribe", err)
+	}
+
+	defer unsubscribe()
+
+	err = bus.Publish(context.Background(), &wfcache.Invalidation{
+		Source: "my_instance",
+		Keys:   []string{"my_key1", "my_key2"},
+	})
+
+	if err != nil {
+		t.Fatalf("Received %v, expected to publish", err)
+	}
+
+	select {
+	case invalidation := <-received:
+		if invalidation.Source != "my_instance" || !reflect.DeepEqual(invalidation.Keys, []string{"my_key1", "my_key2"}) {
+			t.Errorf("Received %v, expected the published invalidation", invalidation)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the invalidation to be received")
+	}
+}
+
+type logEntry struct {
+	level string
+	msg   string
+}
+
+type recordingLogger struct {
+	entries chan logEntry
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.entries <- logEntry{"debug", msg}
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.entries <- logEntry{"info", msg}
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.entries <- logEntry{"warn", msg}
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.entries <- logEntry{"error", msg}
+}
+
+func TestRedisLogger(t *testing.T) {
+	r := RedisClient()
+	ctx := context.Background()
+
+	logger := &recordingLogger{entries: make(chan logEntry, 10)}
+	bus := redisAdapter.NewBus(r, "wfcache-test-logged-invalidations")
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			Logger:          logger,
+			InvalidationBus: bus,
+		},
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+	defer c.Close()
+
+	r.Set(ctx, "my_malformed_key", "not json", time.Minute)
+
+	storages, _ := c.Storages()
+	storages[0].BatchGet(ctx, []string{"my_malformed_key"})
+
+	r.Publish(ctx, "wfcache-test-logged-invalidations", "not json")
+
+	expected := []logEntry{
+		{"warn", "redis: failed to unmarshal item"},
+		{"warn", "redis: failed to get keys"},
+		{"warn", "redis: failed to unmarshal invalidation"},
+	}
+
+	for _, entry := range expected {
+		select {
+		case received := <-logger.entries:
+			if received != entry {
+				t.Errorf("Received %v, expected %v", received, entry)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %v to be logged", entry)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tagged keys are kept in a set per tag, next to a counter of its version
+func tagKey(tag string) string {
+	return "wfcache:tag:" + tag
+}
+
+func tagVersionKey(tag string) string {
+	return "wfcache:tag-version:" + tag
+}
+
+func (s *RedisStorage) TagKeys(ctx context.Context, key string, tags []string) error {
+	return withRetry(ctx, s.logger, func() error {
+		_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, tag := range tags {
+				pipe.SAdd(ctx, tagKey(tag), key)
+
+				// the set outlives the keys added to it
+				if s.ttl > 0 {
+					pipe.Expire(ctx, tagKey(tag), s.ttl)
+				}
+			}
+
+			return nil
+		})
+
+		return err
+	})
+}
+
+func (s *RedisStorage) TaggedKeys(ctx context.Context, tags []string) (keys []string, err error) {
+	tagKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tagKeys = append(tagKeys, tagKey(tag))
+	}
+
+	err = withRetry(ctx, s.logger, func() error {
+		var err error
+
+		keys, err = s.redisClient.SUnion(ctx, tagKeys...).Result()
+
+		return err
+	})
+
+	return keys, err
+}
+
+func (s *RedisStorage) TagVersions(ctx context.Context, tags []string) (map[string]int64, error) {
+	versionKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		versionKeys = append(versionKeys, tagVersionKey(tag))
+	}
+
+	var results []interface{}
+	err := withRetry(ctx, s.logger, func() error {
+		var err error
+
+		results, err = s.redisClient.MGet(ctx, versionKeys...).Result()
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int64, len(tags))
+	for i, result := range results {
+		// tags never invalidated have no version yet
+		if result == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(result.(string), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		versions[tags[i]] = version
+	}
+
+	return versions, nil
+}
+
+// InvalidateTags bumps the version of the tags and forgets their keys.
+// Versions don't expire, as items stamped with them could come back to life.
+func (s *RedisStorage) InvalidateTags(ctx context.Context, tags []string) error {
+	return withRetry(ctx, s.logger, func() error {
+		_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, tag := range tags {
+				pipe.Incr(ctx, tagVersionKey(tag))
+				pipe.Del(ctx, tagKey(tag))
+			}
+
+			return nil
+		})
+
+		return err
+	})
+}
@@ -0,0 +1,260 @@
+package wfcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type lookup struct {
+	done      chan struct{}
+	flight    *flight
+	cacheItem *CacheItem
+	err       error
+}
+
+type lookupFunc func(ctx context.Context, keys []string) ([]*CacheItem, error)
+
+// lookupGroup coalesces concurrent lookups of the same key so that only one
+// of them walks the storage layers (and calls the loader).
+type lookupGroup struct {
+	lookups map[string]*lookup
+
+	mutex sync.Mutex
+}
+
+// do waits on lookups already in flight for any of the keys, and resolves the
+// remaining keys with a single call to fn. fn is not cancelled with ctx, so
+// that a waiter giving up does not cancel the lookup for everyone else, but
+// it's bounded by the latest deadline of those it's shared with (see flight).
+func (g *lookupGroup) do(ctx context.Context, keys []string, fn lookupFunc) ([]*CacheItem, error) {
+	pending := g.start(ctx, keys, fn)
+
+	var cacheItems []*CacheItem
+	var err error
+
+	for _, l := range pending {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if l.err != nil && err == nil {
+			err = l.err
+		}
+
+		if l.cacheItem != nil {
+			cacheItems = append(cacheItems, l.cacheItem)
+		}
+	}
+
+	return cacheItems, err
+}
+
+// start resolves the keys that are not already in flight with a single call
+// to fn without waiting on it, and returns the lookups of all the keys.
+func (g *lookupGroup) start(ctx context.Context, keys []string, fn lookupFunc) []*lookup {
+	pending := make([]*lookup, 0, len(keys))
+	owned := map[string]*lookup{}
+	ownedKeys := []string{}
+
+	g.mutex.Lock()
+	if g.lookups == nil {
+		g.lookups = map[string]*lookup{}
+	}
+
+	var f *flight
+	for _, key := range keys {
+		l, found := g.lookups[key]
+		if found {
+			l.flight.join(ctx)
+		} else {
+			if f == nil {
+				f = newFlight(ctx)
+			}
+
+			l = &lookup{done: make(chan struct{}), flight: f}
+			g.lookups[key] = l
+
+			owned[key] = l
+			ownedKeys = append(ownedKeys, key)
+		}
+
+		pending = append(pending, l)
+	}
+	g.mutex.Unlock()
+
+	if len(ownedKeys) != 0 {
+		go g.resolve(f, ownedKeys, owned, fn)
+	}
+
+	return pending
+}
+
+func (g *lookupGroup) resolve(f *flight, keys []string, lookups map[string]*lookup, fn lookupFunc) {
+	var cacheItems []*CacheItem
+	var err error
+
+	defer func() {
+		f.land()
+
+		if r := recover(); r != nil {
+			err = fmt.Errorf("wfcache: lookup panicked: %v", r)
+		}
+
+		g.mutex.Lock()
+		for _, key := range keys {
+			delete(g.lookups, key)
+		}
+		g.mutex.Unlock()
+
+		for _, cacheItem := range cacheItems {
+			if l, found := lookups[cacheItem.Key]; found {
+				l.cacheItem = cacheItem
+			}
+		}
+
+		// keys that were found are not affected by the error
+		for _, l := range lookups {
+			if l.cacheItem == nil {
+				l.err = err
+			}
+			close(l.done)
+		}
+	}()
+
+	cacheItems, err = fn(f, keys)
+
+	// misses are reported to each waiter by the absence of its item
+	if err == ErrNotFulfilled || err == ErrPartiallyFulfilled {
+		err = nil
+	}
+}
+
+// flight is the context of a lookup shared by several callers. It keeps the
+// values of the context it was started with, but is not cancelled with it.
+// Instead, it's given the latest deadline of the callers sharing it, so that a
+// lookup stuck on a storage or loader that only returns once its context ends
+// doesn't outlive all of them, leaving later callers to wait on it too. It has
+// no deadline once any of them has none.
+type flight struct {
+	parent context.Context
+
+	mutex     sync.Mutex
+	done      chan struct{}
+	err       error
+	deadline  time.Time
+	unbounded bool
+	timer     *time.Timer
+}
+
+func newFlight(ctx context.Context) *flight {
+	f := &flight{
+		parent: ctx,
+		done:   make(chan struct{}),
+	}
+
+	f.join(ctx)
+
+	return f
+}
+
+// join extends the deadline of the flight to that of ctx
+func (f *flight) join(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.err != nil || f.unbounded {
+		return
+	}
+
+	if !ok {
+		f.unbounded = true
+		f.stop()
+
+		return
+	}
+
+	if !f.deadline.IsZero() && !deadline.After(f.deadline) {
+		return
+	}
+
+	f.deadline = deadline
+	f.stop()
+	f.timer = time.AfterFunc(time.Until(deadline), f.expire)
+}
+
+func (f *flight) expire() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// the deadline may have been extended since the timer fired
+	if f.err != nil || f.unbounded || time.Now().Before(f.deadline) {
+		return
+	}
+
+	f.err = context.DeadlineExceeded
+	close(f.done)
+}
+
+// land releases the timer of the flight once the lookup is resolved
+func (f *flight) land() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.stop()
+}
+
+func (f *flight) stop() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+}
+
+func (f *flight) Deadline() (time.Time, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.deadline, !f.unbounded && !f.deadline.IsZero()
+}
+
+func (f *flight) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *flight) Err() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.err
+}
+
+func (f *flight) Value(key interface{}) interface{} {
+	return f.parent.Value(key)
+}
+
+// detachedContext keeps the values of its parent but is never cancelled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,73 @@
+package wfcache
+
+import (
+	"context"
+)
+
+// WithSlidingExpiration makes the storage created by maker push back the
+// expiry of items each time they are read, so that they live for as long as
+// they keep being read.
+func WithSlidingExpiration(maker StorageMaker) StorageMaker {
+	return func() (Storage, error) {
+		storage, err := maker()
+		if err != nil {
+			return nil, err
+		}
+
+		return &slidingStorage{
+			storageWrapper: storageWrapper{storage},
+		}, nil
+	}
+}
+
+type slidingStorage struct {
+	storageWrapper
+}
+
+func (s *slidingStorage) Get(ctx context.Context, key string) *CacheItem {
+	cacheItem, _ := s.Fetch(ctx, key)
+
+	return cacheItem
+}
+
+func (s *slidingStorage) BatchGet(ctx context.Context, keys []string) []*CacheItem {
+	cacheItems, _ := s.BatchFetch(ctx, keys)
+
+	return cacheItems
+}
+
+func (s *slidingStorage) Fetch(ctx context.Context, key string) (*CacheItem, error) {
+	cacheItem, err := AsFetcher(s.storage).Fetch(ctx, key)
+
+	if cacheItem != nil {
+		s.touch(ctx, []*CacheItem{cacheItem})
+	}
+
+	return cacheItem, err
+}
+
+func (s *slidingStorage) BatchFetch(ctx context.Context, keys []string) ([]*CacheItem, error) {
+	cacheItems, err := AsFetcher(s.storage).BatchFetch(ctx, keys)
+
+	if len(cacheItems) != 0 {
+		s.touch(ctx, cacheItems)
+	}
+
+	return cacheItems, err
+}
+
+func (s *slidingStorage) touch(ctx context.Context, cacheItems []*CacheItem) {
+	keys := make([]string, 0, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		if !cacheItem.Absent {
+			keys = append(keys, cacheItem.Key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	// failing to touch an item only means it expires as it would have
+	_ = batchTouch(ctx, s.storage, keys)
+}
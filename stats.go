@@ -0,0 +1,319 @@
+package wfcache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of every storage layer of a cache, since it was
+// created.
+type Stats struct {
+	Layers []LayerStats
+}
+
+// LayerStats counts the keys read from and written to a storage layer, and
+// how long its calls took by operation (e.g. "Get", "BatchGet", "Prime",
+// "Set", "BatchSet", "Tombstone", "Del", "BatchDel").
+type LayerStats struct {
+	Layer int
+	Name  string
+
+	Hits    uint64
+	Misses  uint64
+	Primes  uint64
+	Sets    uint64
+	Deletes uint64
+	Errors  uint64
+
+	Latency map[string]Histogram
+
+	// Sizes are the sizes of the values of the items set and primed.
+	Sizes SizeHistogram
+}
+
+// HitRatio is the share of the keys read from the layer it had, or 0 if it
+// wasn't read from.
+func (s LayerStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Histogram counts observations by bucket. Counts[i] is the number of
+// observations no greater than Buckets[i] (and greater than the previous
+// bucket), and the last count is for observations greater than every bucket.
+type Histogram struct {
+	Buckets []time.Duration
+	Counts  []uint64
+
+	Count uint64
+	Sum   time.Duration
+}
+
+// SizeHistogram counts observations in bytes by bucket, like Histogram.
+type SizeHistogram struct {
+	Buckets []int
+	Counts  []uint64
+
+	Count uint64
+	Sum   int
+}
+
+// LatencyBuckets are the buckets of the latency histograms of LayerStats.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// SizeBuckets are the buckets of the size histograms of LayerStats.
+var SizeBuckets = []int{
+	64,
+	256,
+	1 << 10,
+	4 << 10,
+	16 << 10,
+	64 << 10,
+	256 << 10,
+	1 << 20,
+}
+
+// Stats returns the counters of each storage layer.
+func (c *Cache) Stats() (*Stats, error) {
+	storages, err := c.Storages()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Layers: make([]LayerStats, 0, len(storages)),
+	}
+
+	for i, storage := range storages {
+		layerStats := c.stats.layer(i).snapshot()
+		layerStats.Layer = i
+		layerStats.Name = storageName(storage)
+
+		stats.Layers = append(stats.Layers, layerStats)
+	}
+
+	return stats, nil
+}
+
+type cacheStats struct {
+	layers []*layerStats
+}
+
+func newCacheStats(layers int) *cacheStats {
+	s := &cacheStats{
+		layers: make([]*layerStats, 0, layers),
+	}
+
+	for i := 0; i < layers; i++ {
+		s.layers = append(s.layers, &layerStats{
+			sizes: newSizeHistogram(),
+		})
+	}
+
+	return s
+}
+
+func (s *cacheStats) layer(i int) *layerStats {
+	return s.layers[i]
+}
+
+func (s *cacheStats) got(layer int, op string, hits int, misses int, err error, took time.Duration) {
+	l := s.layer(layer)
+	l.observe(op, err, took)
+
+	atomic.AddUint64(&l.hits, uint64(hits))
+	atomic.AddUint64(&l.misses, uint64(misses))
+}
+
+func (s *cacheStats) primed(layer int, cacheItems []*CacheItem, err error, took time.Duration) {
+	l := s.layer(layer)
+	l.observe("Prime", err, took)
+
+	if err == nil {
+		atomic.AddUint64(&l.primes, uint64(len(cacheItems)))
+		l.observeSizes(cacheItems)
+	}
+}
+
+func (s *cacheStats) set(layer int, op string, cacheItems []*CacheItem, err error, took time.Duration) {
+	l := s.layer(layer)
+	l.observe(op, err, took)
+
+	if err == nil {
+		atomic.AddUint64(&l.sets, uint64(len(cacheItems)))
+		l.observeSizes(cacheItems)
+	}
+}
+
+func (s *cacheStats) deleted(layer int, op string, keys int, err error, took time.Duration) {
+	l := s.layer(layer)
+	l.observe(op, err, took)
+
+	if err == nil {
+		atomic.AddUint64(&l.deletes, uint64(keys))
+	}
+}
+
+func (s *cacheStats) called(layer int, op string, err error, took time.Duration) {
+	s.layer(layer).observe(op, err, took)
+}
+
+type layerStats struct {
+	hits    uint64
+	misses  uint64
+	primes  uint64
+	sets    uint64
+	deletes uint64
+	errors  uint64
+
+	// op name -> *histogram
+	latency sync.Map
+
+	sizes *histogram
+}
+
+func (s *layerStats) observe(op string, err error, took time.Duration) {
+	if err != nil {
+		atomic.AddUint64(&s.errors, 1)
+	}
+
+	h, ok := s.latency.Load(op)
+	if !ok {
+		h, _ = s.latency.LoadOrStore(op, newLatencyHistogram())
+	}
+
+	h.(*histogram).observe(int64(took))
+}
+
+func (s *layerStats) observeSizes(cacheItems []*CacheItem) {
+	for _, cacheItem := range cacheItems {
+		// tombstones have no value
+		if !cacheItem.Absent {
+			s.sizes.observe(int64(len(cacheItem.Value)))
+		}
+	}
+}
+
+func (s *layerStats) snapshot() LayerStats {
+	stats := LayerStats{
+		Hits:    atomic.LoadUint64(&s.hits),
+		Misses:  atomic.LoadUint64(&s.misses),
+		Primes:  atomic.LoadUint64(&s.primes),
+		Sets:    atomic.LoadUint64(&s.sets),
+		Deletes: atomic.LoadUint64(&s.deletes),
+		Errors:  atomic.LoadUint64(&s.errors),
+		Latency: map[string]Histogram{},
+	}
+
+	s.latency.Range(func(op, h interface{}) bool {
+		stats.Latency[op.(string)] = h.(*histogram).latency()
+		return true
+	})
+
+	stats.Sizes = s.sizes.size()
+
+	return stats
+}
+
+type histogram struct {
+	buckets []int64
+	counts  []uint64
+
+	count uint64
+	sum   int64
+}
+
+func newHistogram(buckets []int64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func newLatencyHistogram() *histogram {
+	buckets := make([]int64, 0, len(LatencyBuckets))
+	for _, bucket := range LatencyBuckets {
+		buckets = append(buckets, int64(bucket))
+	}
+
+	return newHistogram(buckets)
+}
+
+func newSizeHistogram() *histogram {
+	buckets := make([]int64, 0, len(SizeBuckets))
+	for _, bucket := range SizeBuckets {
+		buckets = append(buckets, int64(bucket))
+	}
+
+	return newHistogram(buckets)
+}
+
+func (h *histogram) observe(v int64) {
+	i := sort.Search(len(h.buckets), func(i int) bool {
+		return v <= h.buckets[i]
+	})
+
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+}
+
+func (h *histogram) snapshot() ([]uint64, uint64, int64) {
+	counts := make([]uint64, 0, len(h.counts))
+	for i := range h.counts {
+		counts = append(counts, atomic.LoadUint64(&h.counts[i]))
+	}
+
+	return counts, atomic.LoadUint64(&h.count), atomic.LoadInt64(&h.sum)
+}
+
+func (h *histogram) latency() Histogram {
+	counts, count, sum := h.snapshot()
+
+	buckets := make([]time.Duration, 0, len(h.buckets))
+	for _, bucket := range h.buckets {
+		buckets = append(buckets, time.Duration(bucket))
+	}
+
+	return Histogram{
+		Buckets: buckets,
+		Counts:  counts,
+		Count:   count,
+		Sum:     time.Duration(sum),
+	}
+}
+
+func (h *histogram) size() SizeHistogram {
+	counts, count, sum := h.snapshot()
+
+	buckets := make([]int, 0, len(h.buckets))
+	for _, bucket := range h.buckets {
+		buckets = append(buckets, int(bucket))
+	}
+
+	return SizeHistogram{
+		Buckets: buckets,
+		Counts:  counts,
+		Count:   count,
+		Sum:     int(sum),
+	}
+}
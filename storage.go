@@ -0,0 +1,192 @@
+package wfcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ItemStorage is an optional extension of Storage for layers that can store
+// each CacheItem until its own ExpiresAt rather than for the layer-wide ttl.
+// An ExpiresAt of 0 means the layer's default ttl, and layers clamp the
+// expiry to their own ttl (see ClampExpiry). Storages that do not implement
+// it are written to with Set and BatchSet.
+type ItemStorage interface {
+	SetItem(ctx context.Context, item *CacheItem) error
+	BatchSetItems(ctx context.Context, items []*CacheItem) error
+}
+
+// StaleFetcher is optionally implemented by storages that keep expired items
+// for their grace period. BatchFetchStale returns the kept items whether they
+// have expired or not, and is only used when fresh reads fail.
+type StaleFetcher interface {
+	BatchFetchStale(ctx context.Context, keys []string) ([]*CacheItem, error)
+}
+
+// BatchDeleter is optionally implemented by storages that can delete many keys
+// at once. Other storages have their keys deleted one by one.
+type BatchDeleter interface {
+	BatchDel(ctx context.Context, keys []string) error
+}
+
+// Toucher is optionally implemented by storages that can push back the expiry
+// of items to their ttl from now without rewriting them. Other storages have
+// their items read and written again.
+type Toucher interface {
+	BatchTouch(ctx context.Context, keys []string) error
+}
+
+// Namer is optionally implemented by storages to name their layer, e.g. in a
+// LayerError. Other storages are named after their type.
+type Namer interface {
+	Name() string
+}
+
+func storageName(storage Storage) string {
+	if n, ok := storage.(Namer); ok {
+		return n.Name()
+	}
+
+	return fmt.Sprintf("%T", storage)
+}
+
+// Fetcher is an optional, error aware version of the read methods of Storage.
+// A miss is reported as a nil item (or its absence from the results) with a
+// nil error, so that Cache can tell a miss from a failing layer. BatchFetch
+// may return the items it did find along with an error.
+type Fetcher interface {
+	Fetch(ctx context.Context, key string) (*CacheItem, error)
+	BatchFetch(ctx context.Context, keys []string) ([]*CacheItem, error)
+}
+
+// AsFetcher returns storage as a Fetcher. Storages that don't implement
+// Fetcher are adapted so that they never report an error.
+func AsFetcher(storage Storage) Fetcher {
+	if f, ok := storage.(Fetcher); ok {
+		return f
+	}
+
+	return legacyFetcher{storage}
+}
+
+type legacyFetcher struct {
+	storage Storage
+}
+
+func (f legacyFetcher) Fetch(ctx context.Context, key string) (*CacheItem, error) {
+	return f.storage.Get(ctx, key), nil
+}
+
+func (f legacyFetcher) BatchFetch(ctx context.Context, keys []string) ([]*CacheItem, error) {
+	return f.storage.BatchGet(ctx, keys), nil
+}
+
+// ClampExpiry returns the expiry a layer with the given ttl should store an
+// item requested to expire at expiresAt with. A ttl <= 0 means the layer has
+// no maximum.
+func ClampExpiry(expiresAt int64, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return expiresAt
+	}
+
+	maxExpiresAt := time.Now().UTC().Add(ttl).Unix()
+	if expiresAt == 0 || expiresAt > maxExpiresAt {
+		return maxExpiresAt
+	}
+
+	return expiresAt
+}
+
+// storesItems reports whether storage keeps items whole, expiry and tombstones
+// included, rather than just their values
+func storesItems(storage Storage) bool {
+	for s := storage; s != nil; {
+		u, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			_, ok = s.(ItemStorage)
+			return ok
+		}
+
+		s = u.Unwrap()
+	}
+
+	return false
+}
+
+func setItem(ctx context.Context, storage Storage, cacheItem *CacheItem) error {
+	if s, ok := storage.(ItemStorage); ok {
+		return s.SetItem(ctx, cacheItem)
+	}
+
+	// a tombstone stored as a value would be read back as a hit
+	if cacheItem.Absent {
+		return nil
+	}
+
+	return storage.Set(ctx, cacheItem.Key, cacheItem.Value)
+}
+
+func batchSetItems(ctx context.Context, storage Storage, cacheItems []*CacheItem) error {
+	if s, ok := storage.(ItemStorage); ok {
+		return s.BatchSetItems(ctx, cacheItems)
+	}
+
+	pairs := make(map[string][]byte, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		if !cacheItem.Absent {
+			pairs[cacheItem.Key] = cacheItem.Value
+		}
+	}
+
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	return storage.BatchSet(ctx, pairs)
+}
+
+func batchDel(ctx context.Context, storage Storage, keys []string) error {
+	if s, ok := storage.(BatchDeleter); ok {
+		return s.BatchDel(ctx, keys)
+	}
+
+	var delErr error
+	for _, key := range keys {
+		err := storage.Del(ctx, key)
+		if err != nil && delErr == nil {
+			delErr = err
+		}
+	}
+
+	return delErr
+}
+
+func batchTouch(ctx context.Context, storage Storage, keys []string) error {
+	if s, ok := storage.(Toucher); ok {
+		return s.BatchTouch(ctx, keys)
+	}
+
+	cacheItems, err := AsFetcher(storage).BatchFetch(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	touchedCacheItems := []*CacheItem{}
+	for _, cacheItem := range cacheItems {
+		// tombstones keep their own expiry
+		if cacheItem.Absent {
+			continue
+		}
+
+		item := *cacheItem
+		item.ExpiresAt = 0
+
+		touchedCacheItems = append(touchedCacheItems, &item)
+	}
+
+	if len(touchedCacheItems) == 0 {
+		return nil
+	}
+
+	return batchSetItems(ctx, storage, touchedCacheItems)
+}
@@ -0,0 +1,203 @@
+package wfcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TagIndexer is optionally implemented by storages that can keep the index of
+// tagged keys. The first layer implementing it keeps the index for the cache.
+//
+// Besides the keys carrying each tag, the index keeps a version of each tag
+// that InvalidateTags increments. Items are stamped with the versions of their
+// tags when written, so that copies left in layers keys could not be deleted
+// from (e.g. those of other instances) are known to be outdated when read.
+type TagIndexer interface {
+	TagKeys(ctx context.Context, key string, tags []string) error
+	TaggedKeys(ctx context.Context, tags []string) ([]string, error)
+	TagVersions(ctx context.Context, tags []string) (map[string]int64, error)
+	InvalidateTags(ctx context.Context, tags []string) error
+}
+
+// tagIndexer returns the layer keeping the index of tagged keys, if any
+func tagIndexer(storages []Storage) (int, Storage, TagIndexer) {
+	for i, storage := range storages {
+		for s := storage; s != nil; {
+			if indexer, ok := s.(TagIndexer); ok {
+				return i, storage, indexer
+			}
+
+			u, ok := s.(interface{ Unwrap() Storage })
+			if !ok {
+				break
+			}
+
+			s = u.Unwrap()
+		}
+	}
+
+	return -1, nil, nil
+}
+
+var errNoTagIndexer = errors.New("wfcache: tags require a storage layer implementing TagIndexer")
+
+// SetWithTags sets key and records it under each of the tags, so that it's
+// removed with InvalidateTags of any of them.
+func (c *Cache) SetWithTags(ctx context.Context, key string, value interface{}, tags ...string) error {
+	return c.setWithTags(ctx, key, value, 0, tags)
+}
+
+// SetWithTTLAndTags is SetWithTags for an item with its own lifetime.
+func (c *Cache) SetWithTTLAndTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags ...string) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	return c.setWithTags(ctx, key, value, ttl, tags)
+}
+
+func (c *Cache) setWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) (err error) {
+	if len(tags) == 0 {
+		return errors.New("at least one tag is required")
+	}
+
+	storages, err := c.Storages()
+	if err != nil {
+		return err
+	}
+
+	ctx, finish := c.start(ctx, "SetWithTags")
+	defer finish(&err)
+
+	layer, storage, indexer := tagIndexer(storages)
+	if indexer == nil {
+		return errNoTagIndexer
+	}
+
+	v, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// versions are read first, so that an invalidation racing with this write
+	// leaves the item outdated
+	versions, err := indexer.TagVersions(ctx, tags)
+	if err != nil {
+		return &LayerError{Layer: layer, Name: storageName(storage), Op: "TagVersions", Keys: []string{key}, Err: err}
+	}
+
+	err = indexer.TagKeys(ctx, key, tags)
+	if err != nil {
+		return &LayerError{Layer: layer, Name: storageName(storage), Op: "TagKeys", Keys: []string{key}, Err: err}
+	}
+
+	cacheItem := c.newItem(key, v, expiresIn(ttl))
+	cacheItem.Tags = make(map[string]int64, len(tags))
+	for _, tag := range tags {
+		cacheItem.Tags[tag] = versions[tag]
+	}
+
+	err = c.set(ctx, storages, cacheItem)
+
+	return c.publish(ctx, []string{key}, err)
+}
+
+// InvalidateTags removes every key carrying any of the tags from all layers.
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) (err error) {
+	if len(tags) == 0 {
+		return errors.New("at least one tag is required")
+	}
+
+	storages, err := c.Storages()
+	if err != nil {
+		return err
+	}
+
+	ctx, finish := c.start(ctx, "InvalidateTags")
+	defer finish(&err)
+
+	layer, storage, indexer := tagIndexer(storages)
+	if indexer == nil {
+		return errNoTagIndexer
+	}
+
+	keys, err := indexer.TaggedKeys(ctx, tags)
+	if err != nil {
+		return &LayerError{Layer: layer, Name: storageName(storage), Op: "TaggedKeys", Keys: tags, Err: err}
+	}
+
+	// outdate the copies that can't be deleted below before deleting the rest
+	err = indexer.InvalidateTags(ctx, tags)
+	if err != nil {
+		return &LayerError{Layer: layer, Name: storageName(storage), Op: "InvalidateTags", Keys: tags, Err: err}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "InvalidateTags", keys)
+		err := batchDel(lctx, storage, keys)
+		call.deleted(err)
+
+		if err != nil {
+			errs.add(i, storage, "InvalidateTags", keys, err)
+		}
+	}
+
+	return c.publish(ctx, keys, errs.err())
+}
+
+// current leaves out the items carrying a tag invalidated since they were
+// written
+func (c *Cache) current(ctx context.Context, storages []Storage, cacheItems []*CacheItem) []*CacheItem {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, cacheItem := range cacheItems {
+		for tag := range cacheItem.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return cacheItems
+	}
+
+	layer, storage, indexer := tagIndexer(storages)
+	if indexer == nil {
+		return cacheItems
+	}
+
+	versions, err := indexer.TagVersions(ctx, tags)
+	if err != nil {
+		// items are served as is while their tags can't be checked
+		c.errorHandler(ctx, &LayerError{Layer: layer, Name: storageName(storage), Op: "TagVersions", Keys: keysOf(cacheItems), Err: err})
+		return cacheItems
+	}
+
+	currentCacheItems := make([]*CacheItem, 0, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		if !outdated(cacheItem, versions) {
+			currentCacheItems = append(currentCacheItems, cacheItem)
+		}
+	}
+
+	return currentCacheItems
+}
+
+func outdated(cacheItem *CacheItem, versions map[string]int64) bool {
+	for tag, version := range cacheItem.Tags {
+		if versions[tag] > version {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package wfcache
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer traces the calls to a Cache and the storage layer calls they make,
+// e.g. with spans (see wfcache/otel).
+type Tracer interface {
+	// StartOperation starts tracing a call to the cache, such as "Get",
+	// finished with the error it returns. The storage layer calls it makes are
+	// started with the returned context.
+	StartOperation(ctx context.Context, opName string) (context.Context, func(error))
+
+	// StartLayerCall starts tracing a call to a storage layer, finished with
+	// its outcome. The storage layer is called with the returned context.
+	StartLayerCall(ctx context.Context, call LayerCall) (context.Context, func(LayerCall))
+}
+
+// LayerCall describes a call to a storage layer, with its outcome once it's
+// finished. Op is named like in LayerError.
+type LayerCall struct {
+	Layer int
+	Name  string
+	Op    string
+	Keys  []string
+
+	// Hits is how many of the keys read were found.
+	Hits int
+	Err  error
+	Took time.Duration
+}
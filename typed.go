@@ -0,0 +1,106 @@
+package wfcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// TypedCache is a type-safe front-end for a Cache whose values are all of
+// type T. Values are encoded and decoded with the Cache's codec.
+type TypedCache[T any] struct {
+	cache *Cache
+}
+
+func NewTyped[T any](c *Cache) *TypedCache[T] {
+	return &TypedCache[T]{
+		cache: c,
+	}
+}
+
+func (tc *TypedCache[T]) Cache() *Cache {
+	return tc.cache
+}
+
+func (tc *TypedCache[T]) Get(ctx context.Context, key string) (T, error) {
+	cacheItem, err := tc.cache.GetWithContext(ctx, key)
+	if err != nil {
+		var value T
+		return value, err
+	}
+
+	return tc.decodeValue(cacheItem)
+}
+
+func (tc *TypedCache[T]) BatchGet(ctx context.Context, keys []string) (map[string]T, error) {
+	cacheItems, err := tc.cache.BatchGetWithContext(ctx, keys)
+	if err != nil && !errors.Is(err, ErrPartiallyFulfilled) {
+		return nil, err
+	}
+
+	values, decodeErr := tc.decode(cacheItems)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return values, err
+}
+
+func (tc *TypedCache[T]) Set(ctx context.Context, key string, value T) error {
+	return tc.cache.SetWithContext(ctx, key, value)
+}
+
+func (tc *TypedCache[T]) BatchSet(ctx context.Context, pairs map[string]T) error {
+	vPairs := make(map[string]interface{}, len(pairs))
+	for key, value := range pairs {
+		vPairs[key] = value
+	}
+
+	return tc.cache.BatchSetWithContext(ctx, vPairs)
+}
+
+func (tc *TypedCache[T]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context, key string) (T, error)) (T, error) {
+	cacheItem, err := tc.cache.GetOrLoad(ctx, key, func(ctx context.Context, key string) (interface{}, error) {
+		return load(ctx, key)
+	})
+
+	if err != nil {
+		var value T
+		return value, err
+	}
+
+	return tc.decodeValue(cacheItem)
+}
+
+func (tc *TypedCache[T]) decode(cacheItems []*CacheItem) (map[string]T, error) {
+	values := make(map[string]T, len(cacheItems))
+
+	for _, cacheItem := range cacheItems {
+		value, err := tc.decodeValue(cacheItem)
+		if err != nil {
+			return nil, err
+		}
+
+		values[cacheItem.Key] = value
+	}
+
+	return values, nil
+}
+
+// decodeValue decodes the value of an item. Values of pointer types are
+// decoded into a new value they point to, since codecs like protobuf's need
+// the message itself rather than a pointer to it.
+func (tc *TypedCache[T]) decodeValue(cacheItem *CacheItem) (T, error) {
+	var value T
+	out := interface{}(&value)
+
+	if t := reflect.TypeOf(value); t != nil && t.Kind() == reflect.Pointer {
+		ptr := reflect.New(t.Elem())
+		value = ptr.Interface().(T)
+		out = value
+	}
+
+	err := tc.cache.decode(cacheItem, out)
+
+	return value, err
+}
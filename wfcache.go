@@ -2,7 +2,6 @@ package wfcache
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -14,6 +13,53 @@ type CacheItem struct {
 	Key       string `json:"key"`
 	Value     []byte `json:"value"`
 	ExpiresAt int64  `json:"expiresAt"`
+
+	// StaleAt is the soft expiry after which the item is still returned, but
+	// refreshed in the background. 0 means the item doesn't go stale.
+	StaleAt int64 `json:"staleAt,omitempty"`
+
+	// Grace is how long storages keep the item past its expiry, to serve it
+	// when fresh reads fail.
+	Grace time.Duration `json:"grace,omitempty"`
+
+	// Cost is how long the loader took to produce the item.
+	Cost time.Duration `json:"cost,omitempty"`
+
+	// Absent marks a tombstone, recording that the key is known not to exist.
+	Absent bool `json:"absent,omitempty"`
+
+	// Tags are the versions of the tags of the item when it was written.
+	Tags map[string]int64 `json:"tags,omitempty"`
+
+	// ContentType is that of the codec the value was encoded with.
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func (i *CacheItem) Expired() bool {
+	return i.ExpiresAt != 0 && !time.Now().UTC().Before(time.Unix(i.ExpiresAt, 0))
+}
+
+// Stale reports whether the item is past its soft expiry, or past its expiry
+// when it was served because fresh reads failed.
+func (i *CacheItem) Stale() bool {
+	return i.Expired() || (i.StaleAt != 0 && !time.Now().UTC().Before(time.Unix(i.StaleAt, 0)))
+}
+
+// KeepUntil is when storages can drop the item, i.e. its expiry plus grace.
+func (i *CacheItem) KeepUntil() int64 {
+	if i.ExpiresAt == 0 {
+		return 0
+	}
+
+	return time.Unix(i.ExpiresAt, 0).Add(i.Grace).Unix()
+}
+
+// Kept reports whether storages should still keep the item, either because
+// it has not expired or because it is within its grace period.
+func (i *CacheItem) Kept() bool {
+	keepUntil := i.KeepUntil()
+
+	return keepUntil == 0 || time.Now().UTC().Before(time.Unix(keepUntil, 0))
 }
 
 type Storage interface {
@@ -30,11 +76,103 @@ type StorageMaker func() (Storage, error)
 
 type StartStorageOp func(ctx context.Context, opName string) interface{}
 type FinishStorageOp func(interface{})
+type Config struct {
+	StartStorageOp  StartStorageOp
+	FinishStorageOp FinishStorageOp
+
+	// Hooks are called as operations start and finish, and after each call
+	// to a storage layer.
+	Hooks *Hooks
+
+	// Codec encodes values written to and decoded from the storage layers.
+	// Defaults to JSONCodec.
+	Codec Codec
+
+	// ErrorHandler is called with errors that don't fail the operation they
+	// occurred in, e.g. failing to prime a storage layer.
+	ErrorHandler func(ctx context.Context, err error)
+
+	// SoftTTL is how long items written through the cache stay fresh. Stale
+	// items are still returned until they expire, while being refreshed in
+	// the background, once per key. 0 disables stale-while-revalidate.
+	SoftTTL time.Duration
+
+	// Loader refreshes stale items read with Get and BatchGet. GetOrLoad and
+	// BatchGetOrLoad refresh them with their own loader.
+	Loader Loader
+
+	// StaleIfError is how long storages keep items past their expiry. Expired
+	// items are returned, flagged as stale, only when reading them fresh
+	// fails, or loading them does. 0 disables stale-if-error.
+	StaleIfError time.Duration
+
+	// NegativeTTL is how long tombstones of keys missed by every storage
+	// layer, or by the loader, are kept. Reads of a tombstoned key return
+	// ErrNotFulfilled without going further down. 0 disables negative caching.
+	NegativeTTL time.Duration
+
+	// NegativeLayers is how many of the top storage layers keep tombstones.
+	// Defaults to all but the last one.
+	NegativeLayers int
+
+	// EarlyExpiration makes loaded items expire early at random, the closer
+	// they get to their expiry and the longer they took to load, so that only
+	// a few callers refresh them ahead of time (see XFetch). 1 is a good
+	// default, higher values refresh earlier. 0 disables early expiration.
+	EarlyExpiration float64
+
+	// InvalidationBus publishes the keys mutated with Set, BatchSet, Del and
+	// BatchDel, so that other instances evict them from their local layers
+	// (see Localer). Call Close to stop listening to other instances.
+	InvalidationBus InvalidationBus
+
+	// Tracer traces every operation of the cache along with the storage layer
+	// calls it makes.
+	Tracer Tracer
+
+	// Logger logs what the cache recovers from without failing an operation.
+	// It's also given to the storages and invalidation bus implementing
+	// LoggerSetter. Defaults to NopLogger.
+	Logger Logger
+
+	// CircuitBreaker puts a circuit breaker around each storage layer, so that
+	// reads skip a failing layer instead of waiting on it, until it recovers.
+	// Transitions are reported to Hooks.OnCircuitChange. nil disables it.
+	CircuitBreaker *CircuitBreakerConfig
+}
+
 type Cache struct {
 	storages Future
 
-	startOperation  StartStorageOp
-	finishOperation FinishStorageOp
+	hooks []*Hooks
+
+	codec        Codec
+	errorHandler func(ctx context.Context, err error)
+
+	softTTL time.Duration
+	loader  Loader
+	grace   time.Duration
+
+	negativeTTL    time.Duration
+	negativeLayers int
+
+	beta float64
+
+	id          string
+	bus         InvalidationBus
+	unsubscribe func() error
+
+	namespace *namespace
+
+	stats  *cacheStats
+	tracer Tracer
+	logger Logger
+
+	circuitBreaker *CircuitBreakerConfig
+
+	lookups   lookupGroup
+	loads     lookupGroup
+	refreshes lookupGroup
 }
 
 var (
@@ -46,6 +184,7 @@ var nosop = func(ctx context.Context, opName string) interface{} {
 	return nil
 }
 var nofop = func(input interface{}) {}
+var noeh = func(ctx context.Context, err error) {}
 
 func hasDuplicates(keys []string) bool {
 	encountered := map[string]bool{}
@@ -78,29 +217,112 @@ func New(maker StorageMaker, otherMakers ...StorageMaker) (*Cache, error) {
 }
 
 func NewWithHooks(sop StartStorageOp, fop FinishStorageOp, maker StorageMaker, otherMakers ...StorageMaker) (*Cache, error) {
-	var c *Cache
+	return NewWithConfig(
+		Config{
+			StartStorageOp:  sop,
+			FinishStorageOp: fop,
+		},
+		maker,
+		otherMakers...)
+}
+
+func NewWithConfig(conf Config, maker StorageMaker, otherMakers ...StorageMaker) (*Cache, error) {
 	makers := append([]StorageMaker{maker}, otherMakers...)
 
-	c = &Cache{
-		startOperation:  sop,
-		finishOperation: fop,
+	c := &Cache{
+		codec:        conf.Codec,
+		errorHandler: conf.ErrorHandler,
+
+		softTTL: conf.SoftTTL,
+		loader:  conf.Loader,
+		grace:   conf.StaleIfError,
+
+		negativeTTL:    conf.NegativeTTL,
+		negativeLayers: conf.NegativeLayers,
+
+		beta: conf.EarlyExpiration,
+
+		id:  newInstanceID(),
+		bus: conf.InvalidationBus,
+
+		stats:  newCacheStats(len(makers)),
+		tracer: conf.Tracer,
+		logger: conf.Logger,
+
+		circuitBreaker: conf.CircuitBreaker,
+	}
+
+	if conf.StartStorageOp != nil || conf.FinishStorageOp != nil {
+		sop, fop := conf.StartStorageOp, conf.FinishStorageOp
+
+		if sop == nil {
+			sop = nosop
+		}
+
+		if fop == nil {
+			fop = nofop
+		}
+
+		c.hooks = append(c.hooks, storageOpHooks(sop, fop))
+	}
+
+	if conf.Hooks != nil {
+		c.hooks = append(c.hooks, conf.Hooks)
+	}
+
+	if c.codec == nil {
+		c.codec = JSONCodec{}
+	}
+
+	if c.errorHandler == nil {
+		c.errorHandler = noeh
+	}
 
-		storages: Promise(func() (interface{}, error) {
-			return initializeStorages(c, makers)
-		}),
+	if c.logger == nil {
+		c.logger = NopLogger{}
+	} else {
+		setLogger(c.bus, c.logger)
+	}
+
+	c.storages = Promise(func() (interface{}, error) {
+		return initializeStorages(c, makers)
+	})
+
+	if c.bus != nil {
+		unsubscribe, err := c.bus.Subscribe(c.invalidate)
+		if err != nil {
+			return nil, err
+		}
+
+		c.unsubscribe = unsubscribe
 	}
 
 	return c, nil
 }
 
+// Close stops listening to invalidations from other instances.
+func (c *Cache) Close() error {
+	if c.unsubscribe == nil {
+		return nil
+	}
+
+	return c.unsubscribe()
+}
+
 func initializeStorages(c *Cache, makers []StorageMaker) ([]Storage, error) {
 	storages := make([]Storage, 0, len(makers))
-	for _, makeStorage := range makers {
+	for i, makeStorage := range makers {
 		storage, err := makeStorage()
 		if err != nil {
 			return nil, fmt.Errorf(errWFCacheInitialize, err)
 		}
 
+		setLogger(storage, c.logger)
+
+		if c.circuitBreaker != nil {
+			storage = newCircuitStorage(c, i, storage, c.circuitBreaker)
+		}
+
 		storages = append(storages, storage)
 	}
 
@@ -127,49 +349,213 @@ func (c *Cache) Get(key string) (*CacheItem, error) {
 	return c.GetWithContext(context.Background(), key)
 }
 
-func (c *Cache) GetWithContext(ctx context.Context, key string) (*CacheItem, error) {
+func (c *Cache) GetWithContext(ctx context.Context, key string) (cacheItem *CacheItem, err error) {
 	storages, err := c.Storages()
 	if err != nil {
 		return nil, err
 	}
 
-	so := c.startOperation(ctx, "Get")
-	defer c.finishOperation(so)
+	ctx, finish := c.start(ctx, "Get")
+	defer finish(&err)
+
+	cacheItems, err := c.lookups.do(ctx, []string{key}, c.waterfall(storages))
+	if err != nil {
+		return nil, err
+	}
 
-	missingKeyByStorage := map[Storage]string{}
+	if c.loader != nil {
+		c.revalidate(ctx, storages, cacheItems, batchLoader(c.loader))
+	}
+
+	return fulfilledOne(cacheItems)
+}
+
+func (c *Cache) waterfall(storages []Storage) lookupFunc {
+	return func(ctx context.Context, keys []string) ([]*CacheItem, error) {
+		if len(keys) == 1 {
+			cacheItem, err := c.get(ctx, storages, keys[0])
+			if err == ErrNotFulfilled {
+				c.tombstone(ctx, storages, keys)
+				return nil, err
+			}
+
+			if err != nil {
+				return c.staleIfError(ctx, storages, keys, err)
+			}
+
+			return []*CacheItem{cacheItem}, nil
+		}
+
+		cacheItems, missingKeys, err := c.batchGet(ctx, storages, keys)
+
+		if err != nil && err != ErrNotFulfilled && err != ErrPartiallyFulfilled {
+			staleCacheItems, err := c.staleIfError(ctx, storages, missingKeys, err)
+
+			return append(cacheItems, staleCacheItems...), err
+		}
+
+		c.tombstone(ctx, storages, missingKeys)
+
+		return cacheItems, err
+	}
+}
+
+// staleIfError looks up expired items kept for keys that could not be read
+// fresh because of err
+func (c *Cache) staleIfError(ctx context.Context, storages []Storage, keys []string, err error) ([]*CacheItem, error) {
+	if c.grace == 0 {
+		return nil, err
+	}
+
+	cacheItems := []*CacheItem{}
+	missingKeys := keys
 
-	// start waterfall
 	for _, storage := range storages {
-		cacheItem := storage.Get(ctx, key)
+		s, ok := storage.(StaleFetcher)
+		if !ok {
+			continue
+		}
+
+		// layers failing fresh reads are expected to fail these too
+		mds, staleErr := s.BatchFetchStale(ctx, missingKeys)
+		if staleErr != nil {
+			c.logger.Debug("wfcache: failed to read stale items", "storage", storageName(storage), "keys", len(missingKeys), "err", staleErr)
+		}
+
+		if len(mds) != 0 {
+			mKeys1, mKeys2 := funk.DifferenceString(keysOf(mds), missingKeys)
+			missingKeys = append(mKeys1, mKeys2...)
+
+			cacheItems = append(cacheItems, mds...)
+		}
+
+		if len(missingKeys) == 0 {
+			break
+		}
+	}
+
+	if len(cacheItems) == 0 {
+		return nil, err
+	}
+
+	c.errorHandler(ctx, err)
+
+	if len(missingKeys) != 0 {
+		return cacheItems, err
+	}
+
+	return cacheItems, nil
+}
+
+func fulfilledOne(cacheItems []*CacheItem) (*CacheItem, error) {
+	if len(cacheItems) == 0 || cacheItems[0].Absent {
+		return nil, ErrNotFulfilled
+	}
+
+	return cacheItems[0], nil
+}
+
+// fulfilled reports keys missing from cacheItems, along with err if it's the
+// reason they are missing
+func fulfilled(keys []string, cacheItems []*CacheItem, err error) ([]*CacheItem, error) {
+	// tombstoned keys are missing
+	cacheItems = funk.Filter(cacheItems, func(cacheItem *CacheItem) bool {
+		return !cacheItem.Absent
+	}).([]*CacheItem)
+
+	if len(cacheItems) == 0 {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrNotFulfilled
+	}
+
+	if len(cacheItems) != len(keys) {
+		resolvedKeys := keysOf(cacheItems)
+
+		return cacheItems, &PartialError{
+			Missing: funk.FilterString(keys, func(key string) bool {
+				return !funk.ContainsString(resolvedKeys, key)
+			}),
+			Err: err,
+		}
+	}
+
+	return cacheItems, nil
+}
+
+func (c *Cache) get(ctx context.Context, storages []Storage, key string) (*CacheItem, error) {
+	missedLayers := []int{}
+
+	var errs LayerErrors
+
+	// start waterfall
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "Get", []string{key})
+		cacheItem, err := AsFetcher(storage).Fetch(lctx, key)
+
+		if err != nil {
+			call.got(0, 0, err)
+
+			// a failing storage is neither a miss nor primed
+			errs.add(i, storage, "Get", []string{key}, err)
+			continue
+		}
+
+		// items of invalidated tags are misses
+		if cacheItem != nil && len(c.current(ctx, storages, []*CacheItem{cacheItem})) == 0 {
+			cacheItem = nil
+		}
 
 		if cacheItem == nil {
-			missingKeyByStorage[storage] = key
+			call.got(0, 1, nil)
+
+			missedLayers = append(missedLayers, i)
 			continue
 		} else {
-			// prime previous storages
-			for s := range missingKeyByStorage {
-				s.Set(ctx, key, cacheItem.Value)
+			call.got(1, 0, nil)
+
+			// prime previous storages, without outliving the hit
+			for _, layer := range missedLayers {
+				lctx, call := c.startLayerCall(ctx, layer, storages[layer], "Prime", []string{key})
+				err := setItem(lctx, storages[layer], cacheItem)
+				call.primed([]*CacheItem{cacheItem}, err)
+
+				if err != nil {
+					errs.add(layer, storages[layer], "Prime", []string{key}, err)
+				}
 			}
 		}
 
-		// value := interface{}
-		// err := json.Unmarshal(cacheItem.Value, value)
-
-		// if err != nil {
-		// 	return nil, err
-		// }
+		if err := errs.err(); err != nil {
+			c.errorHandler(ctx, err)
+		}
 
 		return cacheItem, nil
 	}
 
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
 	return nil, ErrNotFulfilled
 }
 
+func (c *Cache) GetInto(ctx context.Context, key string, out interface{}) error {
+	cacheItem, err := c.GetWithContext(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return c.decode(cacheItem, out)
+}
+
 func (c *Cache) BatchGet(keys []string) ([]*CacheItem, error) {
 	return c.BatchGetWithContext(context.Background(), keys)
 }
 
-func (c *Cache) BatchGetWithContext(ctx context.Context, keys []string) ([]*CacheItem, error) {
+func (c *Cache) BatchGetWithContext(ctx context.Context, keys []string) (cacheItems []*CacheItem, err error) {
 	if hasDuplicates(keys) {
 		return nil, errors.New("duplicated keys are not allowed")
 	}
@@ -183,22 +569,48 @@ func (c *Cache) BatchGetWithContext(ctx context.Context, keys []string) ([]*Cach
 		return nil, err
 	}
 
-	so := c.startOperation(ctx, "BatchGet")
-	defer c.finishOperation(so)
+	ctx, finish := c.start(ctx, "BatchGet")
+	defer finish(&err)
 
 	if len(keys) == 0 {
 		return nil, errors.New("at least one key is required")
 	}
 
+	cacheItems, err = c.lookups.do(ctx, keys, c.waterfall(storages))
+
+	if c.loader != nil {
+		c.revalidate(ctx, storages, cacheItems, batchLoader(c.loader))
+	}
+
+	return fulfilled(keys, cacheItems, err)
+}
+
+func (c *Cache) batchGet(ctx context.Context, storages []Storage, keys []string) ([]*CacheItem, []string, error) {
 	missingKeys := keys
 
 	cacheItems := []*CacheItem{}
 
-	missingKeysByStorage := map[Storage][]string{}
+	missingKeysByLayer := map[int][]string{}
+
+	var errs LayerErrors
 
 	// start waterfall
-	for _, storage := range storages {
-		mds := storage.BatchGet(ctx, missingKeys)
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "BatchGet", missingKeys)
+		mds, err := AsFetcher(storage).BatchFetch(lctx, missingKeys)
+
+		if err != nil {
+			errs.add(i, storage, "BatchGet", missingKeys, err)
+		}
+
+		// items of invalidated tags are misses
+		mds = c.current(ctx, storages, mds)
+
+		if err != nil {
+			call.got(len(mds), 0, err)
+		} else {
+			call.got(len(mds), len(missingKeys)-len(mds), nil)
+		}
 
 		if len(mds) != 0 {
 			resolvedKeys := funk.Map(mds, func(md *CacheItem) string {
@@ -214,43 +626,90 @@ func (c *Cache) BatchGetWithContext(ctx context.Context, keys []string) ([]*Cach
 			break
 		}
 
-		missingKeysByStorage[storage] = missingKeys
-	}
+		// a failing storage is neither a miss nor primed
+		if err != nil {
+			continue
+		}
 
-	// for _, cacheItem := range cacheItems {
-	// 	if cacheItem != nil {
-	// 		var m interface{}
-	// 		json.Unmarshal(cacheItem.Value, &m)
-	// 		*values = append(*values, m)
-	// 	}
-	// }
+		missingKeysByLayer[i] = missingKeys
+	}
 
 	if len(cacheItems) == 0 {
-		return nil, ErrNotFulfilled
-	}
+		if err := errs.err(); err != nil {
+			return nil, missingKeys, err
+		}
 
-	// prime previous storages
-	for s, misses := range missingKeysByStorage {
-		missedValues := map[string][]byte{}
+		return nil, missingKeys, ErrNotFulfilled
+	}
 
+	// prime previous storages, without outliving the hits
+	for layer, misses := range missingKeysByLayer {
 		missedCacheItems := funk.Filter(cacheItems, func(md *CacheItem) bool {
 			return funk.ContainsString(misses, md.Key)
 		}).([]*CacheItem)
 
-		for _, m := range missedCacheItems {
-			missedValues[m.Key] = m.Value
-		}
+		if len(missedCacheItems) != 0 {
+			lctx, call := c.startLayerCall(ctx, layer, storages[layer], "Prime", keysOf(missedCacheItems))
+			err := batchSetItems(lctx, storages[layer], missedCacheItems)
+			call.primed(missedCacheItems, err)
 
-		if len(missedValues) != 0 {
-			s.BatchSet(ctx, missedValues)
+			if err != nil {
+				errs.add(layer, storages[layer], "Prime", keysOf(missedCacheItems), err)
+			}
 		}
 	}
 
 	if len(missingKeys) != 0 {
-		return cacheItems, ErrPartiallyFulfilled
+		if err := errs.err(); err != nil {
+			return cacheItems, missingKeys, err
+		}
+
+		return cacheItems, missingKeys, ErrPartiallyFulfilled
 	}
 
-	return cacheItems, nil
+	if err := errs.err(); err != nil {
+		c.errorHandler(ctx, err)
+	}
+
+	return cacheItems, nil, nil
+}
+
+func keysOf(cacheItems []*CacheItem) []string {
+	return funk.Map(cacheItems, func(cacheItem *CacheItem) string {
+		return cacheItem.Key
+	}).([]string)
+}
+
+// BatchGetMap is BatchGet with the found items keyed by their key. Missing
+// keys are left out of the map, and reported by the error like with BatchGet.
+func (c *Cache) BatchGetMap(ctx context.Context, keys []string) (map[string]*CacheItem, error) {
+	cacheItems, err := c.BatchGetWithContext(ctx, keys)
+
+	cacheItemsByKey := make(map[string]*CacheItem, len(cacheItems))
+	for _, cacheItem := range cacheItems {
+		cacheItemsByKey[cacheItem.Key] = cacheItem
+	}
+
+	return cacheItemsByKey, err
+}
+
+// BatchGetInto decodes each found key into the value its key points to in outs.
+func (c *Cache) BatchGetInto(ctx context.Context, outs map[string]interface{}) error {
+	keys := funk.Keys(outs).([]string)
+
+	cacheItems, err := c.BatchGetWithContext(ctx, keys)
+	if err != nil && !errors.Is(err, ErrPartiallyFulfilled) {
+		return err
+	}
+
+	for _, cacheItem := range cacheItems {
+		decodeErr := c.decode(cacheItem, outs[cacheItem.Key])
+		if decodeErr != nil {
+			return decodeErr
+		}
+	}
+
+	return err
 }
 
 func (c *Cache) Set(key string, value interface{}) error {
@@ -258,27 +717,50 @@ func (c *Cache) Set(key string, value interface{}) error {
 }
 
 func (c *Cache) SetWithContext(ctx context.Context, key string, value interface{}) error {
+	return c.setWithTTL(ctx, "Set", key, value, 0)
+}
+
+func (c *Cache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	return c.setWithTTL(ctx, "SetWithTTL", key, value, ttl)
+}
+
+func (c *Cache) setWithTTL(ctx context.Context, opName string, key string, value interface{}, ttl time.Duration) (err error) {
 	storages, err := c.Storages()
 	if err != nil {
 		return err
 	}
 
-	so := c.startOperation(ctx, "Set")
-	defer c.finishOperation(so)
+	ctx, finish := c.start(ctx, opName)
+	defer finish(&err)
 
-	v, err := json.Marshal(value)
+	v, err := c.codec.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	for _, storage := range storages {
-		err := storage.Set(ctx, key, v)
+	err = c.set(ctx, storages, c.newItem(key, v, expiresIn(ttl)))
+
+	return c.publish(ctx, []string{key}, err)
+}
+
+func (c *Cache) set(ctx context.Context, storages []Storage, cacheItem *CacheItem) error {
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "Set", []string{cacheItem.Key})
+		err := setItem(lctx, storage, cacheItem)
+		call.set([]*CacheItem{cacheItem}, err)
+
 		if err != nil {
-			return err
+			errs.add(i, storage, "Set", []string{cacheItem.Key}, err)
 		}
 	}
 
-	return nil
+	return errs.err()
 }
 
 func (c *Cache) BatchSet(pairs map[string]interface{}) error {
@@ -286,55 +768,245 @@ func (c *Cache) BatchSet(pairs map[string]interface{}) error {
 }
 
 func (c *Cache) BatchSetWithContext(ctx context.Context, pairs map[string]interface{}) error {
+	return c.batchSetWithTTL(ctx, "BatchSet", pairs, 0)
+}
+
+func (c *Cache) BatchSetWithTTL(ctx context.Context, pairs map[string]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	return c.batchSetWithTTL(ctx, "BatchSetWithTTL", pairs, ttl)
+}
+
+func (c *Cache) batchSetWithTTL(ctx context.Context, opName string, pairs map[string]interface{}, ttl time.Duration) (err error) {
 	storages, err := c.Storages()
 	if err != nil {
 		return err
 	}
 
-	so := c.startOperation(ctx, "BatchSet")
-	defer c.finishOperation(so)
+	ctx, finish := c.start(ctx, opName)
+	defer finish(&err)
 
-	vPairs := map[string][]byte{}
+	expiresAt := expiresIn(ttl)
+
+	cacheItems := make([]*CacheItem, 0, len(pairs))
 	for key, value := range pairs {
-		v, err := json.Marshal(value)
+		v, err := c.codec.Marshal(value)
 		if err != nil {
 			return err
 		}
 
-		vPairs[key] = v
+		cacheItems = append(cacheItems, c.newItem(key, v, expiresAt))
 	}
 
-	for _, storage := range storages {
-		err := storage.BatchSet(ctx, vPairs)
+	err = c.batchSet(ctx, storages, cacheItems)
+
+	return c.publish(ctx, keysOf(cacheItems), err)
+}
+
+func (c *Cache) batchSet(ctx context.Context, storages []Storage, cacheItems []*CacheItem) error {
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "BatchSet", keysOf(cacheItems))
+		err := batchSetItems(lctx, storage, cacheItems)
+		call.set(cacheItems, err)
+
 		if err != nil {
-			return err
+			errs.add(i, storage, "BatchSet", keysOf(cacheItems), err)
 		}
 	}
 
-	return nil
+	return errs.err()
+}
+
+// tombstone records keys confirmed to be missing in the top storage layers
+func (c *Cache) tombstone(ctx context.Context, storages []Storage, keys []string) {
+	if c.negativeTTL == 0 || len(keys) == 0 {
+		return
+	}
+
+	layers := c.negativeLayers
+	if layers == 0 {
+		layers = len(storages) - 1
+	}
+
+	if layers < 1 {
+		layers = 1
+	}
+
+	if layers > len(storages) {
+		layers = len(storages)
+	}
+
+	expiresAt := expiresIn(c.negativeTTL)
+
+	cacheItems := make([]*CacheItem, 0, len(keys))
+	for _, key := range keys {
+		cacheItems = append(cacheItems, &CacheItem{
+			Key:       key,
+			ExpiresAt: expiresAt,
+			Absent:    true,
+		})
+	}
+
+	var errs LayerErrors
+
+	for i, storage := range storages[:layers] {
+		// tombstones of layers that only keep values would be read as hits
+		if !storesItems(storage) {
+			continue
+		}
+
+		lctx, call := c.startLayerCall(ctx, i, storage, "Tombstone", keys)
+		err := batchSetItems(lctx, storage, cacheItems)
+		call.set(cacheItems, err)
+
+		if err != nil {
+			errs.add(i, storage, "Tombstone", keys, err)
+		}
+	}
+
+	if err := errs.err(); err != nil {
+		c.errorHandler(ctx, err)
+	}
+}
+
+// newItem makes an item to be written with the cache's soft expiry, grace and
+// codec
+func (c *Cache) newItem(key string, value []byte, expiresAt int64) *CacheItem {
+	return &CacheItem{
+		Key:       key,
+		Value:     value,
+		ExpiresAt: expiresAt,
+		StaleAt:   expiresIn(c.softTTL),
+		Grace:     c.grace,
+
+		ContentType: c.codec.ContentType(),
+	}
+}
+
+func expiresIn(ttl time.Duration) int64 {
+	if ttl == 0 {
+		return 0
+	}
+
+	return time.Now().UTC().Add(ttl).Unix()
 }
 
 func (c *Cache) Del(key string) error {
 	return c.DelWithContext(context.Background(), key)
 }
 
-func (c *Cache) DelWithContext(ctx context.Context, key string) error {
+func (c *Cache) DelWithContext(ctx context.Context, key string) (err error) {
 	storages, err := c.Storages()
 	if err != nil {
 		return err
 	}
 
-	so := c.startOperation(ctx, "Del")
-	defer c.finishOperation(so)
+	ctx, finish := c.start(ctx, "Del")
+	defer finish(&err)
+
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "Del", []string{key})
+		err := storage.Del(lctx, key)
+		call.deleted(err)
 
-	for _, storage := range storages {
-		err := storage.Del(ctx, key)
 		if err != nil {
-			return err
+			errs.add(i, storage, "Del", []string{key}, err)
 		}
 	}
 
-	return nil
+	return c.publish(ctx, []string{key}, errs.err())
+}
+
+func (c *Cache) BatchDel(keys []string) error {
+	return c.BatchDelWithContext(context.Background(), keys)
+}
+
+func (c *Cache) BatchDelWithContext(ctx context.Context, keys []string) (err error) {
+	if hasDuplicates(keys) {
+		return errors.New("duplicated keys are not allowed")
+	}
+
+	if hasEmptyString(keys) {
+		return errors.New("empty keys are not allowed")
+	}
+
+	storages, err := c.Storages()
+	if err != nil {
+		return err
+	}
+
+	ctx, finish := c.start(ctx, "BatchDel")
+	defer finish(&err)
+
+	if len(keys) == 0 {
+		return errors.New("at least one key is required")
+	}
+
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, "BatchDel", keys)
+		err := batchDel(lctx, storage, keys)
+		call.deleted(err)
+
+		if err != nil {
+			errs.add(i, storage, "BatchDel", keys, err)
+		}
+	}
+
+	return c.publish(ctx, keys, errs.err())
+}
+
+// Touch pushes back the expiry of key in every storage layer, as if it had
+// just been written, without changing its value.
+func (c *Cache) Touch(ctx context.Context, key string) error {
+	return c.batchTouch(ctx, "Touch", []string{key})
+}
+
+func (c *Cache) BatchTouch(ctx context.Context, keys []string) error {
+	if hasDuplicates(keys) {
+		return errors.New("duplicated keys are not allowed")
+	}
+
+	if hasEmptyString(keys) {
+		return errors.New("empty keys are not allowed")
+	}
+
+	if len(keys) == 0 {
+		return errors.New("at least one key is required")
+	}
+
+	return c.batchTouch(ctx, "BatchTouch", keys)
+}
+
+func (c *Cache) batchTouch(ctx context.Context, opName string, keys []string) (err error) {
+	storages, err := c.Storages()
+	if err != nil {
+		return err
+	}
+
+	ctx, finish := c.start(ctx, opName)
+	defer finish(&err)
+
+	var errs LayerErrors
+
+	for i, storage := range storages {
+		lctx, call := c.startLayerCall(ctx, i, storage, opName, keys)
+		err := batchTouch(lctx, storage, keys)
+		call.touched(err)
+
+		if err != nil {
+			errs.add(i, storage, opName, keys, err)
+		}
+	}
+
+	return errs.err()
 }
 
 const errWFCacheInitialize = `error: %s
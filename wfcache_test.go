@@ -3,11 +3,15 @@ package wfcache_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,9 +23,12 @@ import (
 	"github.com/juliaqiuxy/wfcache"
 	basicAdapter "github.com/juliaqiuxy/wfcache/basic"
 	bigCacheAdapter "github.com/juliaqiuxy/wfcache/bigcache"
+	msgpackCodec "github.com/juliaqiuxy/wfcache/codec/msgpack"
+	protobufCodec "github.com/juliaqiuxy/wfcache/codec/protobuf"
 	dynamodbAdapter "github.com/juliaqiuxy/wfcache/dynamodb"
 	goLruAdapter "github.com/juliaqiuxy/wfcache/golru"
 	redisAdapter "github.com/juliaqiuxy/wfcache/redis"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 var dynamodbOnce sync.Once
@@ -244,6 +251,35 @@ func TestWfCacheBatchSetBatchGetWithBigCacheAdapter(t *testing.T) {
 	fmt.Println(items, pairs, err, storages, len(storages))
 }
 
+func TestWfCacheBigCacheAdapterKeepsItemsForItsGrace(t *testing.T) {
+	graced, _ := bigCacheAdapter.CreateWithGrace(time.Second, time.Hour)()
+	ungraced, _ := bigCacheAdapter.Create(time.Second)()
+
+	ctx := context.Background()
+
+	for _, storage := range []wfcache.Storage{graced, ungraced} {
+		storage.(wfcache.ItemStorage).SetItem(ctx, &wfcache.CacheItem{
+			Key:   "my_graced_key",
+			Value: []byte(`"my_value"`),
+			Grace: time.Hour,
+		})
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	items, err := graced.(wfcache.StaleFetcher).BatchFetchStale(ctx, []string{"my_graced_key"})
+
+	if err != nil || len(items) != 1 || !items[0].Expired() {
+		t.Errorf("Received %v (%v), expected the expired item within its grace", items, err)
+	}
+
+	items, err = ungraced.(wfcache.StaleFetcher).BatchFetchStale(ctx, []string{"my_graced_key"})
+
+	if err != nil || len(items) != 0 {
+		t.Errorf("Received %v (%v), expected no grace without CreateWithGrace", items, err)
+	}
+}
+
 func TestWfCacheSetGetWithGoLruAdapter(t *testing.T) {
 	c, _ := wfcache.New(
 		goLruAdapter.Create(64, 30*time.Minute),
@@ -750,3 +786,2136 @@ func TestWfCacheBatchSetBatchGetWithAllAdapters(t *testing.T) {
 
 	fmt.Println(items, pairs, err, storages, len(storages))
 }
+
+func TestWfCacheGetOrLoadWithBasicAdapter(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5 * time.Minute),
+	)
+
+	key := "my_key"
+	val := "my_value"
+
+	loads := 0
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		loads++
+		return val, nil
+	}
+
+	item, err := c.GetOrLoad(context.Background(), key, loader)
+
+	if err != nil {
+		t.Errorf("Expected item to be loaded, got %s", err)
+	}
+
+	var str string
+	json.Unmarshal(item.Value, &str)
+
+	if str != val {
+		t.Errorf("Received %v (type %v), expected %v (type %v)", str, reflect.TypeOf(str), val, reflect.TypeOf(val))
+	}
+
+	item, err = c.GetOrLoad(context.Background(), key, loader)
+
+	if err != nil || item == nil {
+		t.Errorf("Expected item to be cached, got %s", err)
+	}
+
+	if loads != 1 {
+		t.Errorf("Loader called %v times, expected 1", loads)
+	}
+}
+
+func TestWfCacheBatchGetOrLoadWithBasicAdapter(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5 * time.Minute),
+	)
+
+	c.Set("my_key1", "my_value1")
+
+	var loadedKeys []string
+	loader := func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		loadedKeys = keys
+		return map[string]interface{}{
+			"my_key2": "my_value2",
+		}, nil
+	}
+
+	items, err := c.BatchGetOrLoad(context.Background(), []string{"my_key1", "my_key2", "my_key3"}, loader)
+
+	if !errors.Is(err, wfcache.ErrPartiallyFulfilled) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrPartiallyFulfilled)
+	}
+
+	if len(items) != 2 {
+		t.Errorf("Received %v items, expected 2", len(items))
+	}
+
+	if !reflect.DeepEqual(loadedKeys, []string{"my_key2", "my_key3"}) {
+		t.Errorf("Loader received %v, expected only missing keys", loadedKeys)
+	}
+
+	item, err := c.Get("my_key2")
+
+	if err != nil {
+		t.Errorf("Expected loaded item to be cached, got %s", err)
+	}
+
+	var str string
+	json.Unmarshal(item.Value, &str)
+
+	if str != "my_value2" {
+		t.Errorf("Received %v (type %v), expected %v (type %v)", str, reflect.TypeOf(str), "my_value2", reflect.TypeOf("my_value2"))
+	}
+}
+
+func TestWfCacheCoalescesConcurrentGetOrLoad(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5 * time.Minute),
+	)
+
+	key := "my_key"
+	val := "my_value"
+
+	var loads int32
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(50 * time.Millisecond)
+		return val, nil
+	}
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.GetOrLoad(cancelledCtx, key, loader)
+
+	if err != context.Canceled {
+		t.Errorf("Received %v, expected %v", err, context.Canceled)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			item, err := c.GetOrLoad(context.Background(), key, loader)
+
+			if err != nil || item == nil {
+				t.Errorf("Expected item to be loaded, got %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("Loader called %v times, expected 1", loads)
+	}
+}
+
+// countingStorage counts its reads, which take delay, or block until their
+// context ends while blocked
+type countingStorage struct {
+	wfcache.Storage
+
+	delay   time.Duration
+	blocked int32
+	reads   int32
+}
+
+func (s *countingStorage) read(ctx context.Context) error {
+	atomic.AddInt32(&s.reads, 1)
+
+	if atomic.LoadInt32(&s.blocked) == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	time.Sleep(s.delay)
+
+	return nil
+}
+
+func (s *countingStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
+
+	return wfcache.AsFetcher(s.Storage).Fetch(ctx, key)
+}
+
+func (s *countingStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	if err := s.read(ctx); err != nil {
+		return nil, err
+	}
+
+	return wfcache.AsFetcher(s.Storage).BatchFetch(ctx, keys)
+}
+
+func TestWfCacheCoalescesConcurrentBatchGet(t *testing.T) {
+	underlying, _ := basicAdapter.Create(5 * time.Minute)()
+	counting := &countingStorage{Storage: underlying, delay: 50 * time.Millisecond}
+
+	c, _ := wfcache.New(
+		func() (wfcache.Storage, error) {
+			return counting, nil
+		},
+	)
+
+	c.BatchSet(map[string]interface{}{
+		"my_key1": "my_value1",
+		"my_key2": "my_value2",
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			items, err := c.BatchGet([]string{"my_key1", "my_key2", "my_key3"})
+
+			if !errors.Is(err, wfcache.ErrPartiallyFulfilled) {
+				t.Errorf("Received %v, expected %v", err, wfcache.ErrPartiallyFulfilled)
+			}
+
+			if len(items) != 2 {
+				t.Errorf("Received %v items, expected 2", len(items))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counting.reads != 1 {
+		t.Errorf("Storage read %v times, expected 1", counting.reads)
+	}
+}
+
+func TestWfCacheCoalescedLookupEndsWithItsCallers(t *testing.T) {
+	underlying, _ := basicAdapter.Create(5 * time.Minute)()
+	counting := &countingStorage{Storage: underlying, blocked: 1}
+
+	c, _ := wfcache.New(
+		func() (wfcache.Storage, error) {
+			return counting, nil
+		},
+	)
+
+	ctx := context.Background()
+	underlying.Set(ctx, "my_key", []byte(`"my_value"`))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.GetWithContext(timeoutCtx, "my_key")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Received %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// the storage recovers, and the lookup stuck on it must not be joined
+	atomic.StoreInt32(&counting.blocked, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	item, err := c.GetWithContext(timeoutCtx, "my_key")
+
+	if err != nil || item == nil {
+		t.Errorf("Expected item once the storage recovered, got %v", err)
+	}
+}
+
+type profile struct {
+	Name string
+	Age  int
+}
+
+func TestWfCacheGetIntoWithCodecs(t *testing.T) {
+	codecs := []wfcache.Codec{
+		wfcache.JSONCodec{},
+		wfcache.GobCodec{},
+		msgpackCodec.Codec{},
+	}
+
+	for _, codec := range codecs {
+		c, _ := wfcache.NewWithConfig(
+			wfcache.Config{Codec: codec},
+			basicAdapter.Create(5*time.Minute),
+		)
+
+		key := "my_key"
+		val := profile{Name: "julia", Age: 30}
+
+		c.Set(key, val)
+
+		var p profile
+		err := c.GetInto(context.Background(), key, &p)
+
+		if err != nil {
+			t.Errorf("Expected %v to decode, got %s", codec.ContentType(), err)
+		}
+
+		if p != val {
+			t.Errorf("Received %v (type %v), expected %v (type %v)", p, reflect.TypeOf(p), val, reflect.TypeOf(val))
+		}
+	}
+}
+
+func TestWfCacheGetIntoWithProtobufCodec(t *testing.T) {
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{Codec: protobufCodec.Codec{}},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	key := "my_key"
+	val := "my_value"
+
+	c.Set(key, wrapperspb.String(val))
+
+	var str wrapperspb.StringValue
+	err := c.GetInto(context.Background(), key, &str)
+
+	if err != nil {
+		t.Errorf("Expected value to decode, got %s", err)
+	}
+
+	if str.Value != val {
+		t.Errorf("Received %v (type %v), expected %v (type %v)", str.Value, reflect.TypeOf(str.Value), val, reflect.TypeOf(val))
+	}
+
+	err = c.Set(key, val)
+
+	if err == nil {
+		t.Errorf("Expected non proto.Message values to be rejected")
+	}
+}
+
+func TestWfCacheGetIntoCodecMismatch(t *testing.T) {
+	storage, _ := basicAdapter.Create(5 * time.Minute)()
+	shared := func() (wfcache.Storage, error) {
+		return storage, nil
+	}
+
+	jsonCache, _ := wfcache.NewWithConfig(wfcache.Config{Codec: wfcache.JSONCodec{}}, shared)
+	gobCache, _ := wfcache.NewWithConfig(wfcache.Config{Codec: wfcache.GobCodec{}}, shared)
+
+	val := profile{Name: "julia", Age: 30}
+	jsonCache.Set("my_key1", val)
+
+	var p profile
+	err := gobCache.GetInto(context.Background(), "my_key1", &p)
+
+	if !errors.Is(err, wfcache.ErrCodecMismatch) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrCodecMismatch)
+	}
+
+	err = gobCache.BatchGetInto(context.Background(), map[string]interface{}{"my_key1": &p})
+
+	if !errors.Is(err, wfcache.ErrCodecMismatch) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrCodecMismatch)
+	}
+
+	_, err = wfcache.NewTyped[profile](gobCache).Get(context.Background(), "my_key1")
+
+	if !errors.Is(err, wfcache.ErrCodecMismatch) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrCodecMismatch)
+	}
+
+	err = jsonCache.GetInto(context.Background(), "my_key1", &p)
+
+	if err != nil || p != val {
+		t.Errorf("Received %v (%v), expected %v", p, err, val)
+	}
+
+	// items written without a codec are decoded as is
+	storage.Set(context.Background(), "my_key2", []byte(`{"Name":"ava","Age":31}`))
+
+	err = jsonCache.GetInto(context.Background(), "my_key2", &p)
+
+	if err != nil || p.Name != "ava" {
+		t.Errorf("Received %v (%v), expected ava", p, err)
+	}
+}
+
+func TestWfCacheBatchGetIntoWithGobCodec(t *testing.T) {
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{Codec: wfcache.GobCodec{}},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	c.BatchSet(map[string]interface{}{
+		"my_key1": profile{Name: "julia", Age: 30},
+		"my_key2": profile{Name: "ava", Age: 31},
+	})
+
+	var p1, p2, p3 profile
+	err := c.BatchGetInto(context.Background(), map[string]interface{}{
+		"my_key1": &p1,
+		"my_key2": &p2,
+		"my_key3": &p3,
+	})
+
+	if !errors.Is(err, wfcache.ErrPartiallyFulfilled) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrPartiallyFulfilled)
+	}
+
+	if p1.Name != "julia" || p2.Name != "ava" || p3.Name != "" {
+		t.Errorf("Received %v, %v, %v, expected only found keys to be decoded", p1, p2, p3)
+	}
+}
+
+func TestWfCacheTypedCache(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5 * time.Minute),
+	)
+
+	profiles := wfcache.NewTyped[profile](c)
+
+	ctx := context.Background()
+	val := profile{Name: "julia", Age: 30}
+
+	profiles.Set(ctx, "my_key1", val)
+
+	p, err := profiles.Get(ctx, "my_key1")
+
+	if err != nil {
+		t.Errorf("Expected typed value, got %s", err)
+	}
+
+	if p != val {
+		t.Errorf("Received %v (type %v), expected %v (type %v)", p, reflect.TypeOf(p), val, reflect.TypeOf(val))
+	}
+
+	profiles.BatchSet(ctx, map[string]profile{
+		"my_key2": {Name: "ava", Age: 31},
+	})
+
+	ps, err := profiles.BatchGet(ctx, []string{"my_key1", "my_key2", "my_key3"})
+
+	if !errors.Is(err, wfcache.ErrPartiallyFulfilled) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrPartiallyFulfilled)
+	}
+
+	if len(ps) != 2 || ps["my_key1"] != val || ps["my_key2"].Name != "ava" {
+		t.Errorf("Received %v, expected my_key1 and my_key2", ps)
+	}
+
+	p, err = profiles.GetOrLoad(ctx, "my_key4", func(ctx context.Context, key string) (profile, error) {
+		return profile{Name: "emma", Age: 32}, nil
+	})
+
+	if err != nil || p.Name != "emma" {
+		t.Errorf("Received %v (%v), expected loaded profile", p, err)
+	}
+
+	_, err = profiles.Get(ctx, "my_key5")
+
+	if err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrNotFulfilled)
+	}
+}
+
+func TestWfCacheTypedCacheWithProtobufCodec(t *testing.T) {
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{Codec: protobufCodec.Codec{}},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	strs := wfcache.NewTyped[*wrapperspb.StringValue](c)
+
+	ctx := context.Background()
+
+	err := strs.Set(ctx, "my_key1", wrapperspb.String("my_value1"))
+
+	if err != nil {
+		t.Errorf("Expected value to encode, got %s", err)
+	}
+
+	str, err := strs.Get(ctx, "my_key1")
+
+	if err != nil || str.GetValue() != "my_value1" {
+		t.Errorf("Received %v (%v), expected my_value1", str, err)
+	}
+
+	strs.BatchSet(ctx, map[string]*wrapperspb.StringValue{
+		"my_key2": wrapperspb.String("my_value2"),
+	})
+
+	vals, err := strs.BatchGet(ctx, []string{"my_key1", "my_key2"})
+
+	if err != nil || vals["my_key1"].GetValue() != "my_value1" || vals["my_key2"].GetValue() != "my_value2" {
+		t.Errorf("Received %v (%v), expected my_value1 and my_value2", vals, err)
+	}
+
+	str, err = strs.GetOrLoad(ctx, "my_key3", func(ctx context.Context, key string) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String("my_value3"), nil
+	})
+
+	if err != nil || str.GetValue() != "my_value3" {
+		t.Errorf("Received %v (%v), expected my_value3", str, err)
+	}
+}
+
+func TestWfCacheSetWithTTLWithAllAdapters(t *testing.T) {
+	makers := map[string]wfcache.StorageMaker{
+		"golru":    goLruAdapter.Create(64, 30*time.Minute),
+		"bigcache": bigCacheAdapter.Create(30 * time.Minute),
+		"basic":    basicAdapter.Create(5 * time.Minute),
+		"dynamodb": dynamodbAdapter.Create(dynamodbClient, "tests", 6*time.Hour),
+		"redis":    redisAdapter.Create(r, 6*time.Hour),
+	}
+
+	ctx := context.Background()
+	caches := map[string]*wfcache.Cache{}
+
+	for name, maker := range makers {
+		c, _ := wfcache.New(maker)
+		caches[name] = c
+
+		err := c.SetWithTTL(ctx, "my_short_key", "my_value", time.Second)
+		if err != nil {
+			t.Errorf("%v: expected short lived item to be set, got %s", name, err)
+		}
+
+		err = c.BatchSetWithTTL(ctx, map[string]interface{}{"my_long_key": "my_value"}, 24*time.Hour)
+		if err != nil {
+			t.Errorf("%v: expected long lived item to be set, got %s", name, err)
+		}
+
+		item, err := c.Get("my_long_key")
+		if err != nil {
+			t.Errorf("%v: expected long lived item, got %s", name, err)
+		} else if storages, _ := c.Storages(); item.ExpiresAt > time.Now().Add(storages[0].TimeToLive()).Unix() {
+			t.Errorf("%v: expected expiry to be clamped to the layer ttl, got %v", name, time.Unix(item.ExpiresAt, 0))
+		}
+	}
+
+	time.Sleep(2 * time.Second)
+
+	for name, c := range caches {
+		_, err := c.Get("my_short_key")
+
+		if err != wfcache.ErrNotFulfilled {
+			t.Errorf("%v: received %v, expected %v", name, err, wfcache.ErrNotFulfilled)
+		}
+	}
+}
+
+func TestWfCachePrimingPreservesExpiry(t *testing.T) {
+	c, _ := wfcache.New(
+		bigCacheAdapter.Create(30*time.Minute),
+		basicAdapter.Create(6*time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+	expiresAt := time.Now().Add(time.Minute).Unix()
+
+	storages[1].(wfcache.ItemStorage).BatchSetItems(ctx, []*wfcache.CacheItem{
+		{Key: "my_key1", Value: []byte(`"my_value1"`), ExpiresAt: expiresAt},
+		{Key: "my_key2", Value: []byte(`"my_value2"`), ExpiresAt: expiresAt},
+	})
+
+	c.Get("my_key1")
+	c.BatchGet([]string{"my_key2"})
+
+	for _, key := range []string{"my_key1", "my_key2"} {
+		item := storages[0].Get(ctx, key)
+
+		if item == nil {
+			t.Errorf("Expected %v to be primed", key)
+		} else if item.ExpiresAt != expiresAt {
+			t.Errorf("Received expiry %v, expected %v", item.ExpiresAt, expiresAt)
+		}
+	}
+}
+
+var errStorageDown = errors.New("storage is down")
+
+type failingStorage struct {
+	sets int32
+}
+
+func createFailingStorage(s *failingStorage) wfcache.StorageMaker {
+	return func() (wfcache.Storage, error) {
+		return s, nil
+	}
+}
+
+func (s *failingStorage) TimeToLive() time.Duration {
+	return time.Hour
+}
+
+func (s *failingStorage) Get(ctx context.Context, key string) *wfcache.CacheItem {
+	return nil
+}
+
+func (s *failingStorage) BatchGet(ctx context.Context, keys []string) []*wfcache.CacheItem {
+	return nil
+}
+
+func (s *failingStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	return nil, errStorageDown
+}
+
+func (s *failingStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return nil, errStorageDown
+}
+
+func (s *failingStorage) Set(ctx context.Context, key string, value []byte) error {
+	atomic.AddInt32(&s.sets, 1)
+	return errStorageDown
+}
+
+func (s *failingStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	atomic.AddInt32(&s.sets, 1)
+	return errStorageDown
+}
+
+func (s *failingStorage) Del(ctx context.Context, key string) error {
+	return errStorageDown
+}
+
+func TestWfCacheFailingStorageIsNotAMiss(t *testing.T) {
+	failing := &failingStorage{}
+
+	c, _ := wfcache.New(
+		basicAdapter.Create(5*time.Minute),
+		createFailingStorage(failing),
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	storages[2].Set(ctx, "my_key1", []byte(`"my_value1"`))
+	storages[2].Set(ctx, "my_key2", []byte(`"my_value2"`))
+
+	item, err := c.Get("my_key1")
+
+	if err != nil || item == nil {
+		t.Errorf("Expected item from the last storage, got %s", err)
+	}
+
+	items, err := c.BatchGet([]string{"my_key2", "my_key3"})
+
+	if !errors.Is(err, errStorageDown) {
+		t.Errorf("Received %v, expected %v", err, errStorageDown)
+	}
+
+	if len(items) != 1 {
+		t.Errorf("Received %v items, expected 1", len(items))
+	}
+
+	if storages[0].Get(ctx, "my_key1") == nil || storages[0].Get(ctx, "my_key2") == nil {
+		t.Errorf("Expected healthy storages to be primed")
+	}
+
+	if failing.sets != 0 {
+		t.Errorf("Expected failing storage not to be primed, got %v writes", failing.sets)
+	}
+
+	_, err = c.Get("my_key3")
+
+	if !errors.Is(err, errStorageDown) {
+		t.Errorf("Received %v, expected %v", err, errStorageDown)
+	}
+}
+
+func TestWfCacheLayerErrors(t *testing.T) {
+	var handled []error
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			ErrorHandler: func(ctx context.Context, err error) {
+				handled = append(handled, err)
+			},
+		},
+		createFailingStorage(&failingStorage{}),
+		basicAdapter.Create(5*time.Minute),
+		createFailingStorage(&failingStorage{}),
+	)
+
+	err := c.BatchSet(map[string]interface{}{
+		"my_key1": "my_value1",
+		"my_key2": "my_value2",
+	})
+
+	var layerErrs wfcache.LayerErrors
+	if !errors.As(err, &layerErrs) || len(layerErrs) != 2 {
+		t.Fatalf("Received %v, expected errors for 2 layers", err)
+	}
+
+	if layerErrs[0].Layer != 0 || layerErrs[1].Layer != 2 || layerErrs[1].Op != "BatchSet" || len(layerErrs[1].Keys) != 2 {
+		t.Errorf("Received %v, expected BatchSet to fail on layers 0 and 2 for 2 keys", err)
+	}
+
+	if !errors.Is(err, errStorageDown) {
+		t.Errorf("Expected %v to wrap %v", err, errStorageDown)
+	}
+
+	item, err := c.Get("my_key1")
+
+	if err != nil || item == nil {
+		t.Errorf("Expected item from the healthy storage, got %s", err)
+	}
+
+	var layerErr *wfcache.LayerError
+	if len(handled) != 1 || !errors.As(handled[0], &layerErr) {
+		t.Fatalf("Received %v, expected the first layer's read error to be handled", handled)
+	}
+
+	if layerErr.Layer != 0 || layerErr.Op != "Get" || layerErr.Name != "*wfcache_test.failingStorage" {
+		t.Errorf("Received %v, expected layer 0 Get to fail", layerErr)
+	}
+
+	err = c.Del("my_key1")
+
+	if !errors.As(err, &layerErrs) || len(layerErrs) != 2 || layerErrs[0].Op != "Del" {
+		t.Errorf("Received %v, expected Del to fail on 2 layers", err)
+	}
+}
+
+func TestWfCacheLoadWithFailingStorage(t *testing.T) {
+	var handled []error
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			ErrorHandler: func(ctx context.Context, err error) {
+				handled = append(handled, err)
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		createFailingStorage(&failingStorage{}),
+	)
+
+	ctx := context.Background()
+
+	item, err := c.GetOrLoad(ctx, "my_key1", func(ctx context.Context, key string) (interface{}, error) {
+		return "my_value1", nil
+	})
+
+	if err != nil || item == nil || string(item.Value) != `"my_value1"` {
+		t.Errorf("Received %v (%v), expected the loaded item", item, err)
+	}
+
+	items, err := c.BatchGetOrLoad(ctx, []string{"my_key2", "my_key3"}, func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		return map[string]interface{}{"my_key2": "my_value2", "my_key3": "my_value3"}, nil
+	})
+
+	if err != nil || len(items) != 2 {
+		t.Errorf("Received %v (%v), expected the 2 loaded items", items, err)
+	}
+
+	var layerErr *wfcache.LayerError
+	writeErrs := 0
+	for _, err := range handled {
+		if errors.As(err, &layerErr) && (layerErr.Op == "Set" || layerErr.Op == "BatchSet") {
+			writeErrs++
+		}
+	}
+
+	if writeErrs != 2 {
+		t.Errorf("Received %v, expected both write failures to be handled", handled)
+	}
+}
+
+func TestWfCacheBatchGetMapReportsMissingKeys(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5 * time.Minute),
+	)
+
+	c.BatchSet(map[string]interface{}{
+		"my_key1": "my_value1",
+		"my_key3": "my_value3",
+	})
+
+	items, err := c.BatchGetMap(context.Background(), []string{"my_key1", "my_key2", "my_key3", "my_key4"})
+
+	var partialErr *wfcache.PartialError
+	if !errors.As(err, &partialErr) || !errors.Is(err, wfcache.ErrPartiallyFulfilled) {
+		t.Fatalf("Received %v, expected a partial error", err)
+	}
+
+	if !reflect.DeepEqual(partialErr.Missing, []string{"my_key2", "my_key4"}) {
+		t.Errorf("Received %v missing keys, expected [my_key2 my_key4]", partialErr.Missing)
+	}
+
+	if len(items) != 2 || items["my_key1"] == nil || items["my_key3"] == nil {
+		t.Errorf("Received %v, expected my_key1 and my_key3", items)
+	}
+}
+
+func TestWfCacheBatchDelWithAllAdapters(t *testing.T) {
+	c, _ := wfcache.New(
+		goLruAdapter.Create(64, 30*time.Minute),
+		bigCacheAdapter.Create(30*time.Minute),
+		basicAdapter.Create(5*time.Minute),
+		dynamodbAdapter.Create(dynamodbClient, "tests", 6*time.Hour),
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+
+	c.BatchSet(map[string]interface{}{
+		"my_key1": "my_value1",
+		"my_key2": "my_value2",
+		"my_key3": "my_value3",
+	})
+
+	err := c.BatchDel([]string{"my_key1", "my_key2", "my_key4"})
+
+	if err != nil {
+		t.Fatalf("Received %v, expected keys to be deleted", err)
+	}
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	for i, storage := range storages {
+		if storage.Get(ctx, "my_key1") != nil || storage.Get(ctx, "my_key2") != nil {
+			t.Errorf("Expected keys to be deleted from layer %d", i)
+		}
+
+		if storage.Get(ctx, "my_key3") == nil {
+			t.Errorf("Expected my_key3 to be kept in layer %d", i)
+		}
+	}
+}
+
+func TestWfCacheBatchDelFallsBackToDel(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5*time.Minute),
+		createFailingStorage(&failingStorage{}),
+	)
+
+	c.Set("my_key1", "my_value1")
+
+	err := c.BatchDel([]string{"my_key1", "my_key2"})
+
+	var layerErr *wfcache.LayerError
+	if !errors.As(err, &layerErr) || layerErr.Layer != 1 || layerErr.Op != "BatchDel" || len(layerErr.Keys) != 2 {
+		t.Errorf("Received %v, expected BatchDel to fail on layer 1 for 2 keys", err)
+	}
+
+	storages, _ := c.Storages()
+
+	if storages[0].Get(context.Background(), "my_key1") != nil {
+		t.Errorf("Expected my_key1 to be deleted from the healthy layer")
+	}
+}
+
+func TestWfCacheStaleWhileRevalidate(t *testing.T) {
+	var loads int32
+	version := int32(1)
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			SoftTTL: time.Second,
+			Loader: func(ctx context.Context, key string) (interface{}, error) {
+				atomic.AddInt32(&loads, 1)
+				time.Sleep(100 * time.Millisecond)
+				return fmt.Sprintf("my_value%d", atomic.LoadInt32(&version)), nil
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+
+	c.Set("my_swr_key", "my_value1")
+	c.Set("my_swr_key2", "my_value1")
+	atomic.StoreInt32(&version, 2)
+
+	time.Sleep(2 * time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var str string
+			err := c.GetInto(context.Background(), "my_swr_key", &str)
+
+			if err != nil || str != "my_value1" {
+				t.Errorf("Received %v (%v), expected the stale my_value1", str, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(500 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("Expected a single refresh, got %v", n)
+	}
+
+	item, _ := c.Get("my_swr_key")
+
+	var str string
+	json.Unmarshal(item.Value, &str)
+
+	if str != "my_value2" {
+		t.Errorf("Received %v, expected the refreshed my_value2", str)
+	}
+
+	// GetOrLoad keeps serving the stale value while a slow refresh runs
+	slowLoad := func(ctx context.Context, key string) (interface{}, error) {
+		time.Sleep(time.Second)
+		return "my_value2", nil
+	}
+
+	c.GetOrLoad(context.Background(), "my_swr_key2", slowLoad)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			item, err := c.GetOrLoad(context.Background(), "my_swr_key2", slowLoad)
+
+			if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+				t.Errorf("Expected GetOrLoad not to wait on the refresh, took %v", elapsed)
+			}
+
+			if err != nil || string(item.Value) != `"my_value1"` {
+				t.Errorf("Received %v (%v), expected the stale my_value1", item, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWfCacheStaleIfError(t *testing.T) {
+	var handled int32
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			StaleIfError: time.Minute,
+			ErrorHandler: func(ctx context.Context, err error) {
+				atomic.AddInt32(&handled, 1)
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		redisAdapter.Create(r, 6*time.Hour),
+		createFailingStorage(&failingStorage{}),
+	)
+
+	ctx := context.Background()
+
+	c.SetWithTTL(ctx, "my_sie_key1", "my_value1", time.Second)
+	c.SetWithTTL(ctx, "my_sie_key2", "my_value2", time.Second)
+
+	time.Sleep(2 * time.Second)
+
+	item, err := c.Get("my_sie_key1")
+
+	if err != nil || item == nil || !item.Stale() {
+		t.Fatalf("Received %v (%v), expected a stale item", item, err)
+	}
+
+	items, err := c.BatchGet([]string{"my_sie_key2", "my_sie_key3"})
+
+	if !errors.Is(err, errStorageDown) || len(items) != 1 || !items[0].Stale() {
+		t.Errorf("Received %v (%v), expected a stale item and the storage error", items, err)
+	}
+
+	item, err = c.GetOrLoad(ctx, "my_sie_key1", func(ctx context.Context, key string) (interface{}, error) {
+		return nil, errors.New("source is down")
+	})
+
+	if err != nil || item == nil || !item.Stale() {
+		t.Errorf("Received %v (%v), expected a stale item when the loader fails", item, err)
+	}
+
+	if atomic.LoadInt32(&handled) != 3 {
+		t.Errorf("Expected the 3 errors hidden by stale items to be handled, got %v", handled)
+	}
+
+	c, _ = wfcache.NewWithConfig(
+		wfcache.Config{
+			StaleIfError: time.Minute,
+		},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	c.SetWithTTL(ctx, "my_sie_key1", "my_value1", time.Second)
+
+	time.Sleep(2 * time.Second)
+
+	_, err = c.Get("my_sie_key1")
+
+	if err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected expired items not to be served without errors", err)
+	}
+}
+
+func TestWfCacheNegativeCaching(t *testing.T) {
+	var loads int32
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			NegativeTTL: time.Minute,
+		},
+		basicAdapter.Create(5*time.Minute),
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	storages[1].Del(ctx, "my_absent_key1")
+	storages[1].Del(ctx, "my_absent_key2")
+
+	_, err := c.Get("my_absent_key1")
+
+	if err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrNotFulfilled)
+	}
+
+	if item := storages[0].Get(ctx, "my_absent_key1"); item == nil || !item.Absent {
+		t.Errorf("Expected a tombstone in the top layer, got %v", item)
+	}
+
+	if storages[1].Get(ctx, "my_absent_key1") != nil {
+		t.Errorf("Expected no tombstone in the last layer")
+	}
+
+	// the tombstone hides values written to lower layers directly
+	storages[1].Set(ctx, "my_absent_key1", []byte(`"my_value1"`))
+
+	_, err = c.Get("my_absent_key1")
+
+	if err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected the tombstone to fulfill the look up", err)
+	}
+
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, wfcache.ErrNotFulfilled
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = c.GetOrLoad(ctx, "my_absent_key2", load)
+
+		if err != wfcache.ErrNotFulfilled {
+			t.Errorf("Received %v, expected %v", err, wfcache.ErrNotFulfilled)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("Expected the loader to be called once, got %v", loads)
+	}
+
+	c.Set("my_present_key", "my_value")
+
+	items, err := c.BatchGet([]string{"my_absent_key1", "my_absent_key2", "my_present_key"})
+
+	var partialErr *wfcache.PartialError
+	if !errors.As(err, &partialErr) || len(items) != 1 || len(partialErr.Missing) != 2 {
+		t.Errorf("Received %v (%v), expected tombstoned keys to be missing", items, err)
+	}
+
+	c.Set("my_absent_key1", "my_value1")
+
+	item, err := c.Get("my_absent_key1")
+
+	if err != nil || item.Absent {
+		t.Errorf("Received %v (%v), expected Set to clear the tombstone", item, err)
+	}
+}
+
+// legacyStorage only implements Storage
+type legacyStorage struct {
+	wfcache.Storage
+}
+
+func TestWfCacheNegativeCachingSkipsLegacyStorages(t *testing.T) {
+	underlying, _ := basicAdapter.Create(5 * time.Minute)()
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			NegativeTTL:    time.Minute,
+			NegativeLayers: 2,
+		},
+		func() (wfcache.Storage, error) {
+			return legacyStorage{underlying}, nil
+		},
+		basicAdapter.Create(5*time.Minute),
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	for i := 0; i < 2; i++ {
+		item, err := c.Get("my_absent_key")
+
+		if err != wfcache.ErrNotFulfilled || item != nil {
+			t.Errorf("Received %v (%v), expected %v", item, err, wfcache.ErrNotFulfilled)
+		}
+	}
+
+	if item := underlying.Get(ctx, "my_absent_key"); item != nil {
+		t.Errorf("Expected no tombstone in the legacy layer, got %v", item)
+	}
+
+	if item := storages[1].Get(ctx, "my_absent_key"); item == nil || !item.Absent {
+		t.Errorf("Expected a tombstone in the second layer, got %v", item)
+	}
+}
+
+func TestWfCacheEarlyExpiration(t *testing.T) {
+	for _, tc := range []struct {
+		beta  float64
+		loads int32
+	}{
+		{beta: 1, loads: 0},
+		{beta: 1e9, loads: 1},
+	} {
+		var loads int32
+
+		c, _ := wfcache.NewWithConfig(
+			wfcache.Config{
+				EarlyExpiration: tc.beta,
+			},
+			basicAdapter.Create(5*time.Minute),
+		)
+
+		ctx := context.Background()
+		storages, _ := c.Storages()
+
+		storages[0].(wfcache.ItemStorage).SetItem(ctx, &wfcache.CacheItem{
+			Key:   "my_key",
+			Value: []byte(`"my_value"`),
+			Cost:  50 * time.Millisecond,
+		})
+
+		load := func(ctx context.Context, key string) (interface{}, error) {
+			atomic.AddInt32(&loads, 1)
+			return "my_new_value", nil
+		}
+
+		item, err := c.GetOrLoad(ctx, "my_key", load)
+
+		if err != nil || string(item.Value) != `"my_value"` {
+			t.Errorf("Received %v (%v), expected the cached item", item, err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		if n := atomic.LoadInt32(&loads); n != tc.loads {
+			t.Errorf("Received %v loads with early expiration %v, expected %v", n, tc.beta, tc.loads)
+		}
+
+		item, _ = c.Get("my_key")
+
+		if tc.loads != 0 && item.Cost == 0 {
+			t.Errorf("Expected the refreshed item to record its load cost")
+		}
+	}
+}
+
+func TestWfCacheTTLConfig(t *testing.T) {
+	c, _ := wfcache.New(
+		wfcache.WithTTLConfig(basicAdapter.Create(time.Hour), wfcache.TTLConfig{
+			Policy: func(key string, value []byte) time.Duration {
+				if strings.HasPrefix(key, "hot:") {
+					return 30 * time.Minute
+				}
+
+				return time.Minute
+			},
+		}),
+		wfcache.WithTTLConfig(redisAdapter.Create(r, time.Hour), wfcache.TTLConfig{
+			Jitter: 0.25,
+		}),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.BatchSet(map[string]interface{}{
+		"hot:my_key": "my_value",
+		"my_key":     "my_value",
+	})
+
+	now := time.Now().Unix()
+
+	if item := storages[0].Get(ctx, "hot:my_key"); item == nil || item.ExpiresAt-now < 29*60 || item.ExpiresAt-now > 30*60 {
+		t.Errorf("Expected hot:my_key to expire in 30 minutes, got %v", item)
+	}
+
+	if item := storages[0].Get(ctx, "my_key"); item == nil || item.ExpiresAt-now > 60 {
+		t.Errorf("Expected my_key to expire in a minute, got %v", item)
+	}
+
+	// ±25% around 45 minutes, below the layer's ttl
+	shorter, longer := 0, 0
+	earliest, latest := int64(math.MaxInt64), int64(0)
+	for i := 0; i < 20; i++ {
+		c.Set("my_key", "my_value")
+
+		item := storages[1].Get(ctx, "my_key")
+		if item == nil || item.ExpiresAt-now < 30*60-1 || item.ExpiresAt-now > 60*60+1 {
+			t.Fatalf("Expected my_key to expire in 30 to 60 minutes, got %v", item)
+		}
+
+		if item.ExpiresAt-now < 45*60 {
+			shorter++
+		} else {
+			longer++
+		}
+
+		if item.ExpiresAt < earliest {
+			earliest = item.ExpiresAt
+		}
+
+		if item.ExpiresAt > latest {
+			latest = item.ExpiresAt
+		}
+	}
+
+	if shorter == 0 || longer == 0 || latest-earliest < 5*60 {
+		t.Errorf("Expected expiries spread both ways, got %v shorter and %v longer, spread over %vs", shorter, longer, latest-earliest)
+	}
+
+	if _, ok := storages[1].(wfcache.Namer); !ok || storages[1].(wfcache.Namer).Name() != "redis" {
+		t.Errorf("Expected the decorated storage to keep its name")
+	}
+}
+
+func TestWfCacheTouchWithAllAdapters(t *testing.T) {
+	c, _ := wfcache.New(
+		goLruAdapter.Create(64, 30*time.Minute),
+		bigCacheAdapter.Create(30*time.Minute),
+		basicAdapter.Create(30*time.Minute),
+		dynamodbAdapter.Create(dynamodbClient, "tests", 30*time.Minute),
+		redisAdapter.Create(r, 30*time.Minute),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.BatchSetWithTTL(ctx, map[string]interface{}{
+		"my_touch_key1": "my_value1",
+		"my_touch_key2": "my_value2",
+	}, time.Minute)
+
+	err := c.Touch(ctx, "my_touch_key1")
+
+	if err != nil {
+		t.Fatalf("Received %v, expected my_touch_key1 to be touched", err)
+	}
+
+	err = c.BatchTouch(ctx, []string{"my_touch_key2", "my_touch_key3"})
+
+	if err != nil {
+		t.Fatalf("Received %v, expected my_touch_key2 to be touched", err)
+	}
+
+	now := time.Now().Unix()
+
+	for i, storage := range storages {
+		for _, key := range []string{"my_touch_key1", "my_touch_key2"} {
+			item := storage.Get(ctx, key)
+
+			if item == nil || item.ExpiresAt-now < 29*60 {
+				t.Errorf("Expected %v to expire in 30 minutes in layer %d, got %v", key, i, item)
+				continue
+			}
+
+			var str string
+			json.Unmarshal(item.Value, &str)
+
+			if !strings.HasPrefix(str, "my_value") {
+				t.Errorf("Expected the value of %v to be kept in layer %d, got %v", key, i, str)
+			}
+		}
+
+		if storage.Get(ctx, "my_touch_key3") != nil {
+			t.Errorf("Expected touching a missing key not to create it in layer %d", i)
+		}
+	}
+}
+
+func TestWfCacheSlidingExpiration(t *testing.T) {
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			NegativeTTL:    time.Minute,
+			NegativeLayers: 1,
+		},
+		wfcache.WithSlidingExpiration(basicAdapter.Create(time.Hour)),
+		redisAdapter.Create(r, time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.SetWithTTL(ctx, "my_session", "my_value", time.Minute)
+
+	item, err := c.Get("my_session")
+
+	if err != nil || item == nil {
+		t.Fatalf("Received %v, expected my_session", err)
+	}
+
+	now := time.Now().Unix()
+
+	if item := storages[0].Get(ctx, "my_session"); item == nil || item.ExpiresAt-now < 59*60 {
+		t.Errorf("Expected reading my_session to extend it to an hour, got %v", item)
+	}
+
+	if item := storages[1].Get(ctx, "my_session"); item == nil || item.ExpiresAt-now > 60 {
+		t.Errorf("Expected my_session to keep its expiry in the layer without sliding expiration, got %v", item)
+	}
+
+	storages[1].Del(ctx, "my_absent_session")
+	c.Get("my_absent_session")
+	c.Get("my_absent_session")
+
+	if item := storages[0].Get(ctx, "my_absent_session"); item == nil || !item.Absent || item.ExpiresAt-now > 60 {
+		t.Errorf("Expected tombstones to keep their expiry, got %v", item)
+	}
+}
+
+func TestWfCacheInvalidationBus(t *testing.T) {
+	bus := wfcache.NewMemoryBus()
+
+	newCache := func() (*wfcache.Cache, []wfcache.Storage) {
+		c, _ := wfcache.NewWithConfig(
+			wfcache.Config{
+				InvalidationBus: bus,
+			},
+			basicAdapter.Create(5*time.Minute),
+			redisAdapter.Create(r, 6*time.Hour),
+		)
+
+		storages, _ := c.Storages()
+
+		return c, storages
+	}
+
+	c1, storages1 := newCache()
+	c2, storages2 := newCache()
+	defer c1.Close()
+	defer c2.Close()
+
+	ctx := context.Background()
+
+	c1.Set("my_shared_key", "my_value1")
+	c2.Get("my_shared_key")
+
+	if storages2[0].Get(ctx, "my_shared_key") == nil {
+		t.Fatalf("Expected the local layer to be primed")
+	}
+
+	c1.Set("my_shared_key", "my_value2")
+
+	if storages2[0].Get(ctx, "my_shared_key") != nil {
+		t.Errorf("Expected Set to evict the key from other local layers")
+	}
+
+	if storages1[0].Get(ctx, "my_shared_key") == nil {
+		t.Errorf("Expected Set to keep the key in its own local layer")
+	}
+
+	var str string
+	c2.GetInto(ctx, "my_shared_key", &str)
+
+	if str != "my_value2" {
+		t.Errorf("Received %v, expected my_value2", str)
+	}
+
+	c1.Del("my_shared_key")
+
+	if storages2[0].Get(ctx, "my_shared_key") != nil {
+		t.Errorf("Expected Del to evict the key from other local layers")
+	}
+
+	c2.Close()
+	c2.BatchSet(map[string]interface{}{"my_shared_key": "my_value3"})
+	c1.BatchSet(map[string]interface{}{"my_shared_key": "my_value4"})
+
+	if storages2[0].Get(ctx, "my_shared_key") == nil {
+		t.Errorf("Expected a closed cache to stop evicting keys")
+	}
+}
+
+func TestWfCacheTags(t *testing.T) {
+	newCache := func() (*wfcache.Cache, []wfcache.Storage) {
+		c, _ := wfcache.New(
+			basicAdapter.Create(5*time.Minute),
+			redisAdapter.Create(r, 6*time.Hour),
+		)
+
+		storages, _ := c.Storages()
+
+		return c, storages
+	}
+
+	c1, _ := newCache()
+	c2, storages2 := newCache()
+
+	ctx := context.Background()
+
+	c1.SetWithTags(ctx, "user:1:profile", "my_profile", "user:1")
+	c1.SetWithTags(ctx, "user:1:feed:1", "my_feed", "user:1", "feeds")
+	c1.SetWithTags(ctx, "user:2:profile", "my_profile", "user:2")
+
+	items, err := c2.BatchGet([]string{"user:1:profile", "user:1:feed:1", "user:2:profile"})
+
+	if err != nil || len(items) != 3 {
+		t.Fatalf("Received %v (%v), expected the tagged items", items, err)
+	}
+
+	err = c1.InvalidateTags(ctx, "user:1")
+
+	if err != nil {
+		t.Fatalf("Received %v, expected user:1 to be invalidated", err)
+	}
+
+	if storages2[0].Get(ctx, "user:1:profile") == nil {
+		t.Fatalf("Expected the other cache to keep its own copy")
+	}
+
+	for _, c := range []*wfcache.Cache{c1, c2} {
+		_, err = c.Get("user:1:profile")
+
+		if err != wfcache.ErrNotFulfilled {
+			t.Errorf("Received %v, expected user:1:profile to be invalidated", err)
+		}
+
+		items, err = c.BatchGet([]string{"user:1:feed:1", "user:2:profile"})
+
+		if len(items) != 1 || items[0].Key != "user:2:profile" {
+			t.Errorf("Received %v (%v), expected only user:2:profile", items, err)
+		}
+	}
+
+	c1.SetWithTags(ctx, "user:1:profile", "my_new_profile", "user:1")
+
+	var str string
+	err = c2.GetInto(ctx, "user:1:profile", &str)
+
+	if err != nil || str != "my_new_profile" {
+		t.Errorf("Received %v (%v), expected the profile written after the invalidation", str, err)
+	}
+
+	c3, _ := wfcache.New(basicAdapter.Create(5 * time.Minute))
+
+	if err := c3.SetWithTags(ctx, "my_key", "my_value", "my_tag"); err == nil {
+		t.Errorf("Expected tags to require a tag index")
+	}
+}
+
+func TestWfCacheNamespace(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5*time.Minute),
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+
+	ctx := context.Background()
+
+	team1 := c.Namespace("team:1")
+	team2 := c.Namespace("team:2")
+
+	team1.Set("my_ns_key", "my_value1")
+	team2.Set("my_ns_key", "my_value2")
+
+	var str string
+	team1.GetInto(ctx, "my_ns_key", &str)
+
+	if str != "my_value1" {
+		t.Errorf("Received %v, expected my_value1", str)
+	}
+
+	str = ""
+	team2.GetInto(ctx, "my_ns_key", &str)
+
+	if str != "my_value2" {
+		t.Errorf("Received %v, expected my_value2", str)
+	}
+
+	if _, err := c.Get("my_ns_key"); err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected namespaced keys to be hidden from the cache", err)
+	}
+
+	items, err := team1.BatchGet([]string{"my_ns_key", "my_missing_ns_key"})
+
+	if len(items) != 1 || items[0].Key != "my_ns_key" {
+		t.Errorf("Received %v (%v), expected the logical key", items, err)
+	}
+
+	err = c.BumpNamespace(ctx, "team:1")
+
+	if err != nil {
+		t.Fatalf("Received %v, expected team:1 to be bumped", err)
+	}
+
+	if _, err := team1.Get("my_ns_key"); err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected team:1 keys to be invalidated", err)
+	}
+
+	if _, err := c.Namespace("team:1").Get("my_ns_key"); err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected new views to share the bumped generation", err)
+	}
+
+	if _, err := team2.Get("my_ns_key"); err != nil {
+		t.Errorf("Received %v, expected team:2 keys to be kept", err)
+	}
+
+	team1.Set("my_ns_key", "my_value3")
+
+	str = ""
+	team1.GetInto(ctx, "my_ns_key", &str)
+
+	if str != "my_value3" {
+		t.Errorf("Received %v, expected my_value3", str)
+	}
+
+	nested := team2.Namespace("users")
+	nested.Set("my_ns_key", "my_value4")
+
+	team2.BumpNamespace(ctx, "users")
+
+	if _, err := nested.Get("my_ns_key"); err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected nested keys to be invalidated", err)
+	}
+
+	if _, err := team2.Get("my_ns_key"); err != nil {
+		t.Errorf("Received %v, expected the parent namespace to be kept", err)
+	}
+}
+
+func TestWfCacheNamespaceOutlivesItsKeys(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(3 * time.Second),
+	)
+
+	team := c.Namespace("team:ttl")
+
+	team.Set("my_ns_key1", "my_value1")
+
+	time.Sleep(2 * time.Second)
+
+	team.Set("my_ns_key2", "my_value2")
+
+	// the generation first written has expired, my_ns_key2 has not
+	time.Sleep(1500 * time.Millisecond)
+
+	if _, err := team.Get("my_ns_key2"); err != nil {
+		t.Errorf("Received %v, expected the key to outlive the generation first written", err)
+	}
+}
+
+func TestWfCacheNamespaceSharedBetweenInstances(t *testing.T) {
+	storage, _ := basicAdapter.Create(5 * time.Minute)()
+	shared := func() (wfcache.Storage, error) {
+		return storage, nil
+	}
+
+	a, _ := wfcache.New(basicAdapter.Create(5*time.Minute), shared)
+	b, _ := wfcache.New(basicAdapter.Create(5*time.Minute), shared)
+
+	ctx := context.Background()
+
+	b.Namespace("team:shared").Set("my_ns_key1", "my_value1")
+
+	if _, err := a.Namespace("team:shared").Get("my_ns_key1"); err != nil {
+		t.Fatalf("Received %v, expected the key written by the other instance", err)
+	}
+
+	a.BumpNamespace(ctx, "team:shared")
+
+	// b still has the previous generation on its own layer, due for a refresh
+	time.Sleep(1100 * time.Millisecond)
+
+	b.Namespace("team:shared").Set("my_ns_key2", "my_value2")
+
+	c, _ := wfcache.New(basicAdapter.Create(5*time.Minute), shared)
+
+	if _, err := c.Namespace("team:shared").Get("my_ns_key1"); err != wfcache.ErrNotFulfilled {
+		t.Errorf("Received %v, expected the bump not to be reverted", err)
+	}
+
+	if _, err := c.Namespace("team:shared").Get("my_ns_key2"); err != nil {
+		t.Errorf("Received %v, expected the key to be written to the bumped generation", err)
+	}
+}
+
+func TestWfCacheNamespaceStats(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5 * time.Minute),
+	)
+
+	team := c.Namespace("team:stats")
+
+	team.Set("my_ns_key", "my_value")
+	team.Get("my_ns_key")
+
+	stats, _ := c.Stats()
+	l1 := stats.Layers[0]
+
+	// resolving the generation of the namespace is not counted
+	if l1.Hits != 1 || l1.Misses != 0 || l1.Sets != 1 {
+		t.Errorf("Received %+v, expected only the Set and Get to be counted", l1)
+	}
+}
+
+func TestWfCacheStats(t *testing.T) {
+	c, _ := wfcache.New(
+		basicAdapter.Create(5*time.Minute),
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.BatchSet(map[string]interface{}{"my_stats_key1": "my_value1", "my_stats_key2": "my_value2"})
+	storages[0].Del(ctx, "my_stats_key1")
+
+	c.Get("my_stats_key1")
+	c.Get("my_stats_key1")
+	c.BatchGet([]string{"my_stats_key2", "my_missing_stats_key"})
+	c.Del("my_stats_key2")
+
+	stats, err := c.Stats()
+
+	if err != nil || len(stats.Layers) != 2 {
+		t.Fatalf("Received %v (%v), expected the stats of 2 layers", stats, err)
+	}
+
+	l1, l2 := stats.Layers[0], stats.Layers[1]
+
+	if l1.Name != "basic" || l2.Name != "redis" {
+		t.Errorf("Received %v and %v, expected the layers to be named", l1.Name, l2.Name)
+	}
+
+	if l1.Hits != 2 || l1.Misses != 2 || l1.Primes != 1 || l1.Sets != 2 || l1.Deletes != 1 || l1.Errors != 0 {
+		t.Errorf("Received %+v, expected the first layer to be counted", l1)
+	}
+
+	if l2.Hits != 1 || l2.Misses != 1 || l2.Primes != 0 || l2.Sets != 2 || l2.Deletes != 1 || l2.Errors != 0 {
+		t.Errorf("Received %+v, expected the second layer to be counted", l2)
+	}
+
+	if l1.HitRatio() != 0.5 {
+		t.Errorf("Received %v, expected a hit ratio of 0.5", l1.HitRatio())
+	}
+
+	latency := l1.Latency["Get"]
+
+	if latency.Count != 2 || len(latency.Counts) != len(latency.Buckets)+1 || latency.Sum <= 0 {
+		t.Errorf("Received %+v, expected 2 Get latencies", latency)
+	}
+
+	var count uint64
+	for _, n := range latency.Counts {
+		count += n
+	}
+
+	if count != latency.Count {
+		t.Errorf("Received %v, expected the buckets to add up to %v", count, latency.Count)
+	}
+
+	if l2.Latency["BatchGet"].Count != 1 || l2.Latency["Prime"].Count != 0 {
+		t.Errorf("Received %+v, expected latencies by op", l2.Latency)
+	}
+
+	if l1.Sizes.Count != 3 || l1.Sizes.Sum != 3*len(`"my_value1"`) {
+		t.Errorf("Received %+v, expected the sizes of the items set and primed", l1.Sizes)
+	}
+}
+
+func TestWfCacheHooks(t *testing.T) {
+	var mutex sync.Mutex
+	calls := []string{}
+
+	record := func(format string, a ...interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		calls = append(calls, fmt.Sprintf(format, a...))
+	}
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			StartStorageOp: func(ctx context.Context, opName string) interface{} {
+				record("start %s", opName)
+				return opName
+			},
+			FinishStorageOp: func(so interface{}) {
+				record("finish %v", so)
+			},
+			Hooks: &wfcache.Hooks{
+				OnLayerGet: func(ctx context.Context, layer int, keys []string, hits int, err error, took time.Duration) {
+					record("get %d %v %d %v", layer, keys, hits, err)
+				},
+				OnPrime: func(ctx context.Context, layer int, keys []string, err error) {
+					record("prime %d %v %v", layer, keys, err)
+				},
+				OnSet: func(ctx context.Context, layer int, keys []string, err error) {
+					record("set %d %v %v", layer, keys, err)
+				},
+				OnDel: func(ctx context.Context, layer int, keys []string, err error) {
+					record("del %d %v %v", layer, keys, err)
+				},
+				OnTouch: func(ctx context.Context, layer int, keys []string, err error) {
+					record("touch %d %v %v", layer, keys, err)
+				},
+				OnFinish: func(ctx context.Context, op string, err error) {
+					record("on finish %s %v", op, err)
+				},
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		redisAdapter.Create(r, 6*time.Hour),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	c.Set("my_hooked_key", "my_value")
+	storages[0].Del(ctx, "my_hooked_key")
+	c.Get("my_hooked_key")
+	c.Touch(ctx, "my_hooked_key")
+	c.Del("my_hooked_key")
+	c.Get("my_hooked_key")
+
+	expected := []string{
+		"start Set",
+		"set 0 [my_hooked_key] <nil>",
+		"set 1 [my_hooked_key] <nil>",
+		"on finish Set <nil>",
+		"finish Set",
+		"start Get",
+		"get 0 [my_hooked_key] 0 <nil>",
+		"get 1 [my_hooked_key] 1 <nil>",
+		"prime 0 [my_hooked_key] <nil>",
+		"on finish Get <nil>",
+		"finish Get",
+		"start Touch",
+		"touch 0 [my_hooked_key] <nil>",
+		"touch 1 [my_hooked_key] <nil>",
+		"on finish Touch <nil>",
+		"finish Touch",
+		"start Del",
+		"del 0 [my_hooked_key] <nil>",
+		"del 1 [my_hooked_key] <nil>",
+		"on finish Del <nil>",
+		"finish Del",
+		"start Get",
+		"get 0 [my_hooked_key] 0 <nil>",
+		"get 1 [my_hooked_key] 0 <nil>",
+		"on finish Get look up not fulfilled",
+		"finish Get",
+	}
+
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Received %v, expected %v", calls, expected)
+	}
+}
+
+// unwritableStorage misses every read and fails every write
+type unwritableStorage struct {
+	*failingStorage
+}
+
+func (s unwritableStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	return nil, nil
+}
+
+func (s unwritableStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	return nil, nil
+}
+
+type recordingLogger struct {
+	mutex   sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level string, msg string, keysAndValues []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = append(l.entries, fmt.Sprintf("%s %s %v", level, msg, keysAndValues))
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.record("debug", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record("info", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.record("warn", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.record("error", msg, keysAndValues)
+}
+
+func TestWfCacheLogger(t *testing.T) {
+	logger := &recordingLogger{}
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			Logger: logger,
+		},
+		func() (wfcache.Storage, error) {
+			return unwritableStorage{&failingStorage{}}, nil
+		},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	storages[1].Set(ctx, "my_key", []byte(`"my_value"`))
+
+	_, err := c.Get("my_key")
+
+	if err != nil {
+		t.Fatalf("Received %v, expected the hit to be returned", err)
+	}
+
+	expected := []string{
+		"warn wfcache: failed to prime storage layer [layer 0 storage wfcache_test.unwritableStorage keys 1 err storage is down]",
+	}
+
+	if !reflect.DeepEqual(logger.entries, expected) {
+		t.Errorf("Received %v, expected %v", logger.entries, expected)
+	}
+}
+
+// flakyStorage fails every call while it's down, and writes while its
+// writes are down
+type flakyStorage struct {
+	wfcache.Storage
+
+	down       int32
+	writesDown int32
+	calls      int32
+}
+
+func (s *flakyStorage) call() error {
+	atomic.AddInt32(&s.calls, 1)
+
+	if atomic.LoadInt32(&s.down) == 1 {
+		return errStorageDown
+	}
+
+	return nil
+}
+
+func (s *flakyStorage) write() error {
+	if err := s.call(); err != nil {
+		return err
+	}
+
+	if atomic.LoadInt32(&s.writesDown) == 1 {
+		return errStorageDown
+	}
+
+	return nil
+}
+
+func (s *flakyStorage) Fetch(ctx context.Context, key string) (*wfcache.CacheItem, error) {
+	if err := s.call(); err != nil {
+		return nil, err
+	}
+
+	return wfcache.AsFetcher(s.Storage).Fetch(ctx, key)
+}
+
+func (s *flakyStorage) BatchFetch(ctx context.Context, keys []string) ([]*wfcache.CacheItem, error) {
+	if err := s.call(); err != nil {
+		return nil, err
+	}
+
+	return wfcache.AsFetcher(s.Storage).BatchFetch(ctx, keys)
+}
+
+func (s *flakyStorage) Set(ctx context.Context, key string, value []byte) error {
+	if err := s.write(); err != nil {
+		return err
+	}
+
+	return s.Storage.Set(ctx, key, value)
+}
+
+func (s *flakyStorage) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	if err := s.write(); err != nil {
+		return err
+	}
+
+	return s.Storage.BatchSet(ctx, pairs)
+}
+
+func (s *flakyStorage) Del(ctx context.Context, key string) error {
+	if err := s.write(); err != nil {
+		return err
+	}
+
+	return s.Storage.Del(ctx, key)
+}
+
+func TestWfCacheCircuitBreaker(t *testing.T) {
+	var mutex sync.Mutex
+	transitions := []string{}
+
+	underlying, _ := basicAdapter.Create(5 * time.Minute)()
+	flaky := &flakyStorage{Storage: underlying, down: 1}
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			CircuitBreaker: &wfcache.CircuitBreakerConfig{
+				Threshold: 2,
+				CoolDown:  50 * time.Millisecond,
+				QueueSize: 10,
+			},
+			Hooks: &wfcache.Hooks{
+				OnCircuitChange: func(ctx context.Context, layer int, from wfcache.CircuitState, to wfcache.CircuitState) {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					transitions = append(transitions, fmt.Sprintf("%d %s -> %s", layer, from, to))
+				},
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		func() (wfcache.Storage, error) {
+			return flaky, nil
+		},
+		basicAdapter.Create(5*time.Minute),
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	storages[2].Set(ctx, "my_key1", []byte(`"my_value1"`))
+	storages[2].Set(ctx, "my_key2", []byte(`"my_value2"`))
+
+	// failing twice in a row opens the circuit
+	c.Get("my_key1")
+	c.Get("my_key2")
+
+	calls := atomic.LoadInt32(&flaky.calls)
+	storages[0].Del(ctx, "my_key1")
+
+	item, err := c.Get("my_key1")
+
+	if err != nil || item == nil {
+		t.Errorf("Expected item from the last storage, got %v", err)
+	}
+
+	if atomic.LoadInt32(&flaky.calls) != calls {
+		t.Errorf("Expected the open layer to be skipped")
+	}
+
+	_, err = wfcache.AsFetcher(storages[1]).Fetch(ctx, "my_key1")
+
+	if !errors.Is(err, wfcache.ErrCircuitOpen) {
+		t.Errorf("Received %v, expected %v", err, wfcache.ErrCircuitOpen)
+	}
+
+	// writes are held back while the circuit is open
+	err = c.Set("my_key3", "my_value3")
+
+	if err != nil {
+		t.Errorf("Received %v, expected the write to be queued", err)
+	}
+
+	if atomic.LoadInt32(&flaky.calls) != calls {
+		t.Errorf("Expected the write to the open layer to be queued")
+	}
+
+	// once cooled down, a successful probe replays the writes held back
+	atomic.StoreInt32(&flaky.down, 0)
+	time.Sleep(60 * time.Millisecond)
+
+	storages[0].Del(ctx, "my_key1")
+	c.Get("my_key1")
+
+	if underlying.Get(ctx, "my_key3") == nil {
+		t.Errorf("Expected the queued write to be replayed")
+	}
+
+	expected := []string{
+		"1 closed -> open",
+		"1 open -> half-open",
+		"1 half-open -> closed",
+	}
+
+	if !reflect.DeepEqual(transitions, expected) {
+		t.Errorf("Received %v, expected %v", transitions, expected)
+	}
+}
+
+func TestWfCacheCircuitBreakerProbeReplayFails(t *testing.T) {
+	var mutex sync.Mutex
+	transitions := []string{}
+
+	underlying, _ := basicAdapter.Create(5 * time.Minute)()
+	flaky := &flakyStorage{Storage: underlying, down: 1}
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			CircuitBreaker: &wfcache.CircuitBreakerConfig{
+				Threshold: 2,
+				CoolDown:  50 * time.Millisecond,
+				QueueSize: 10,
+			},
+			Hooks: &wfcache.Hooks{
+				OnCircuitChange: func(ctx context.Context, layer int, from wfcache.CircuitState, to wfcache.CircuitState) {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					transitions = append(transitions, fmt.Sprintf("%d %s -> %s", layer, from, to))
+				},
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		func() (wfcache.Storage, error) {
+			return flaky, nil
+		},
+	)
+
+	ctx := context.Background()
+	storages, _ := c.Storages()
+
+	underlying.Set(ctx, "my_key1", []byte(`"my_value1"`))
+
+	// failing twice in a row opens the circuit, and the write is held back
+	c.Get("my_key2")
+	c.Get("my_key2")
+	c.Set("my_key3", "my_value3")
+
+	// the read probing the layer succeeds, replaying the write doesn't
+	atomic.StoreInt32(&flaky.down, 0)
+	atomic.StoreInt32(&flaky.writesDown, 1)
+	time.Sleep(60 * time.Millisecond)
+
+	item, err := c.Get("my_key1")
+
+	if err != nil || item == nil {
+		t.Errorf("Received %v (%v), expected the item read by the probe", item, err)
+	}
+
+	if underlying.Get(ctx, "my_key3") != nil {
+		t.Errorf("Expected the queued write not to be replayed")
+	}
+
+	// the next probe replays it
+	atomic.StoreInt32(&flaky.writesDown, 0)
+	time.Sleep(60 * time.Millisecond)
+
+	storages[0].Del(ctx, "my_key1")
+	c.Get("my_key1")
+
+	if underlying.Get(ctx, "my_key3") == nil {
+		t.Errorf("Expected the queued write to be replayed")
+	}
+
+	expected := []string{
+		"1 closed -> open",
+		"1 open -> half-open",
+		"1 half-open -> open",
+		"1 open -> half-open",
+		"1 half-open -> closed",
+	}
+
+	if !reflect.DeepEqual(transitions, expected) {
+		t.Errorf("Received %v, expected %v", transitions, expected)
+	}
+}
+
+func TestWfCacheCircuitBreakerWithoutQueue(t *testing.T) {
+	var mutex sync.Mutex
+	transitions := []string{}
+
+	underlying, _ := basicAdapter.Create(5 * time.Minute)()
+	flaky := &flakyStorage{Storage: underlying, down: 1}
+
+	c, _ := wfcache.NewWithConfig(
+		wfcache.Config{
+			CircuitBreaker: &wfcache.CircuitBreakerConfig{
+				Threshold: 2,
+				CoolDown:  50 * time.Millisecond,
+			},
+			Hooks: &wfcache.Hooks{
+				OnCircuitChange: func(ctx context.Context, layer int, from wfcache.CircuitState, to wfcache.CircuitState) {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					transitions = append(transitions, fmt.Sprintf("%d %s -> %s", layer, from, to))
+				},
+			},
+		},
+		basicAdapter.Create(5*time.Minute),
+		func() (wfcache.Storage, error) {
+			return flaky, nil
+		},
+	)
+
+	ctx := context.Background()
+
+	// failing twice in a row opens the circuit
+	c.Set("my_key1", "my_value1")
+	c.Set("my_key2", "my_value2")
+
+	// writes are dropped while the circuit is open
+	calls := atomic.LoadInt32(&flaky.calls)
+	err := c.Set("my_key3", "my_value3")
+
+	if err != nil {
+		t.Errorf("Received %v, expected the write to be dropped", err)
+	}
+
+	if atomic.LoadInt32(&flaky.calls) != calls {
+		t.Errorf("Expected the write to the open layer to be dropped")
+	}
+
+	// once cooled down, a write probes the layer itself
+	time.Sleep(60 * time.Millisecond)
+
+	err = c.Set("my_key4", "my_value4")
+
+	if !errors.Is(err, errStorageDown) {
+		t.Errorf("Received %v, expected %v", err, errStorageDown)
+	}
+
+	if atomic.LoadInt32(&flaky.calls) != calls+1 {
+		t.Errorf("Expected the write to probe the layer")
+	}
+
+	atomic.StoreInt32(&flaky.down, 0)
+	time.Sleep(60 * time.Millisecond)
+
+	err = c.Set("my_key5", "my_value5")
+
+	if err != nil {
+		t.Errorf("Received %v, expected the write to succeed", err)
+	}
+
+	if underlying.Get(ctx, "my_key5") == nil {
+		t.Errorf("Expected the write probing the layer to be stored")
+	}
+
+	expected := []string{
+		"1 closed -> open",
+		"1 open -> half-open",
+		"1 half-open -> open",
+		"1 open -> half-open",
+		"1 half-open -> closed",
+	}
+
+	if !reflect.DeepEqual(transitions, expected) {
+		t.Errorf("Received %v, expected %v", transitions, expected)
+	}
+}
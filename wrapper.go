@@ -0,0 +1,85 @@
+package wfcache
+
+import (
+	"context"
+	"time"
+)
+
+// storageWrapper forwards every method of a storage, including the optional
+// ones, so that decorators only need to override what they change.
+type storageWrapper struct {
+	storage Storage
+}
+
+// Unwrap returns the decorated storage.
+func (w *storageWrapper) Unwrap() Storage {
+	return w.storage
+}
+
+func (w *storageWrapper) Name() string {
+	return storageName(w.storage)
+}
+
+func (w *storageWrapper) Local() bool {
+	return isLocal(w.storage)
+}
+
+func (w *storageWrapper) SetLogger(logger Logger) {
+	setLogger(w.storage, logger)
+}
+
+func (w *storageWrapper) TimeToLive() time.Duration {
+	return w.storage.TimeToLive()
+}
+
+func (w *storageWrapper) Get(ctx context.Context, key string) *CacheItem {
+	return w.storage.Get(ctx, key)
+}
+
+func (w *storageWrapper) BatchGet(ctx context.Context, keys []string) []*CacheItem {
+	return w.storage.BatchGet(ctx, keys)
+}
+
+func (w *storageWrapper) Fetch(ctx context.Context, key string) (*CacheItem, error) {
+	return AsFetcher(w.storage).Fetch(ctx, key)
+}
+
+func (w *storageWrapper) BatchFetch(ctx context.Context, keys []string) ([]*CacheItem, error) {
+	return AsFetcher(w.storage).BatchFetch(ctx, keys)
+}
+
+func (w *storageWrapper) BatchFetchStale(ctx context.Context, keys []string) ([]*CacheItem, error) {
+	if s, ok := w.storage.(StaleFetcher); ok {
+		return s.BatchFetchStale(ctx, keys)
+	}
+
+	return nil, nil
+}
+
+func (w *storageWrapper) Set(ctx context.Context, key string, value []byte) error {
+	return w.storage.Set(ctx, key, value)
+}
+
+func (w *storageWrapper) BatchSet(ctx context.Context, pairs map[string][]byte) error {
+	return w.storage.BatchSet(ctx, pairs)
+}
+
+func (w *storageWrapper) SetItem(ctx context.Context, cacheItem *CacheItem) error {
+	return setItem(ctx, w.storage, cacheItem)
+}
+
+func (w *storageWrapper) BatchSetItems(ctx context.Context, cacheItems []*CacheItem) error {
+	return batchSetItems(ctx, w.storage, cacheItems)
+}
+
+func (w *storageWrapper) Del(ctx context.Context, key string) error {
+	return w.storage.Del(ctx, key)
+}
+
+func (w *storageWrapper) BatchTouch(ctx context.Context, keys []string) error {
+	return batchTouch(ctx, w.storage, keys)
+}
+
+func (w *storageWrapper) BatchDel(ctx context.Context, keys []string) error {
+	return batchDel(ctx, w.storage, keys)
+}